@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MrHakimov/wallet/pkg/wallet"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println("Использование: auditverify <путь к журналу аудита>")
+		os.Exit(2)
+	}
+
+	entries, err := wallet.ReadAuditFromFile(os.Args[1])
+	if err != nil {
+		switch err {
+		case wallet.ErrFileNotFound:
+			fmt.Println("Журнал аудита не найден!")
+		case wallet.ErrAuditEntryFormat:
+			fmt.Println("Журнал аудита повреждён!")
+		default:
+			fmt.Println(err)
+		}
+		os.Exit(1)
+	}
+
+	index, err := wallet.VerifyAudit(entries)
+	if err != nil {
+		entry := entries[index]
+		fmt.Printf("Цепочка нарушена на записи #%d (seq %d, аккаунт %d, операция %s)\n",
+			index, entry.Seq, entry.AccountID, entry.Operation)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Цепочка не нарушена, записей: %d\n", len(entries))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MrHakimov/wallet/pkg/wallet"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println("Использование: reconcile <папка с выгрузкой>")
+		os.Exit(2)
+	}
+
+	report, err := wallet.ReconcileDumps(os.Args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	err = report.WriteJSON(os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+
+	if !report.OK() {
+		fmt.Fprintf(os.Stderr, "Найдено расхождений: %d\n", len(report.Issues))
+		os.Exit(1)
+	}
+}
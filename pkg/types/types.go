@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 // Money represents type for storing money
 type Money int64
 
@@ -23,6 +25,10 @@ type Payment struct {
 	Amount    Money
 	Category  PaymentCategory
 	Status    PaymentStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// ParentID links fee to the payment it was charged for, it is empty for ordinary payments
+	ParentID string
 }
 
 // Favorite is used for featured payments
@@ -32,20 +38,37 @@ type Favorite struct {
 	Name      string
 	Amount    Money
 	Category  PaymentCategory
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // Phone is used for telephone numbers
 type Phone string
 
+// AccountStatus represents state of account, empty status is treated as active
+type AccountStatus string
+
+// account statuses
+const (
+	AccountStatusActive AccountStatus = "ACTIVE"
+	AccountStatusFrozen AccountStatus = "FROZEN"
+	AccountStatusClosed AccountStatus = "CLOSED"
+)
+
 // Account is used to store user's data
 type Account struct {
-	ID      int64
-	Phone   Phone
-	Balance Money
+	ID        int64
+	Phone     Phone
+	Balance   Money
+	Status    AccountStatus
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 // Progress is used to store sum calculation progress
 type Progress struct {
 	Part   int
 	Result Money
+	// Done is set for the last message which contains total of all parts
+	Done bool
 }
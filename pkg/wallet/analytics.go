@@ -0,0 +1,159 @@
+package wallet
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// AnalyticsQuery describes which payments are aggregated, zero From or To means unbounded window
+type AnalyticsQuery struct {
+	From       time.Time
+	To         time.Time
+	Goroutines int
+}
+
+// CategoryStats is aggregated spending of one category
+type CategoryStats struct {
+	Category types.PaymentCategory
+	Count    int
+	Total    types.Money
+	Average  types.Money
+	P50      types.Money
+	P90      types.Money
+	P99      types.Money
+}
+
+// SpendingReport contains spending per category for every account and for the whole wallet
+type SpendingReport struct {
+	Global    []CategoryStats
+	ByAccount map[int64][]CategoryStats
+}
+
+// categoryAmounts collects amounts of payments grouped by category
+type categoryAmounts map[types.PaymentCategory][]types.Money
+
+func (c categoryAmounts) merge(other categoryAmounts) {
+	for category, amounts := range other {
+		c[category] = append(c[category], amounts...)
+	}
+}
+
+// SpendingAnalytics aggregates payments which were not rejected within the query window.
+// Payments are split between goroutines in the same way as SumPayments does,
+// non-positive Goroutines means one goroutine per CPU
+func (s *Service) SpendingAnalytics(query AnalyticsQuery) *SpendingReport {
+	global := categoryAmounts{}
+	byAccount := make(map[int64]categoryAmounts)
+
+	_ = s.MapReducePayments(context.Background(), query.Goroutines, func(ctx context.Context, payments []*types.Payment) (interface{}, error) {
+		current := make(map[int64]categoryAmounts)
+
+		for index, payment := range payments {
+			if err := canceled(ctx, index); err != nil {
+				return nil, err
+			}
+
+			if !query.matches(payment) {
+				continue
+			}
+
+			account, ok := current[payment.AccountID]
+			if !ok {
+				account = categoryAmounts{}
+				current[payment.AccountID] = account
+			}
+			account[payment.Category] = append(account[payment.Category], payment.Amount)
+		}
+
+		return current, nil
+	}, func(part interface{}) {
+		for accountID, amounts := range part.(map[int64]categoryAmounts) {
+			global.merge(amounts)
+
+			account, ok := byAccount[accountID]
+			if !ok {
+				account = categoryAmounts{}
+				byAccount[accountID] = account
+			}
+			account.merge(amounts)
+		}
+	})
+
+	report := &SpendingReport{
+		Global:    global.stats(),
+		ByAccount: make(map[int64][]CategoryStats, len(byAccount)),
+	}
+
+	for accountID, amounts := range byAccount {
+		report.ByAccount[accountID] = amounts.stats()
+	}
+
+	return report
+}
+
+// AccountSpending returns spending per category of one account
+func (s *Service) AccountSpending(accountID int64, query AnalyticsQuery) ([]CategoryStats, error) {
+	_, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, ErrAccountNotFound
+	}
+
+	return s.SpendingAnalytics(query).ByAccount[accountID], nil
+}
+
+func (q AnalyticsQuery) matches(payment *types.Payment) bool {
+	if payment.Status == types.PaymentStatusFail {
+		return false
+	}
+
+	if !q.From.IsZero() && payment.CreatedAt.Before(q.From) {
+		return false
+	}
+
+	if !q.To.IsZero() && !payment.CreatedAt.Before(q.To) {
+		return false
+	}
+
+	return true
+}
+
+func (c categoryAmounts) stats() []CategoryStats {
+	result := make([]CategoryStats, 0, len(c))
+
+	for category, amounts := range c {
+		sort.Slice(amounts, func(i, j int) bool {
+			return amounts[i] < amounts[j]
+		})
+
+		stats := CategoryStats{Category: category, Count: len(amounts)}
+		for _, amount := range amounts {
+			stats.Total += amount
+		}
+
+		stats.Average = stats.Total / types.Money(stats.Count)
+		stats.P50 = percentile(amounts, 50)
+		stats.P90 = percentile(amounts, 90)
+		stats.P99 = percentile(amounts, 99)
+
+		result = append(result, stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Category < result[j].Category
+	})
+
+	return result
+}
+
+// percentile uses nearest-rank method on sorted amounts
+func percentile(sorted []types.Money, p int) types.Money {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
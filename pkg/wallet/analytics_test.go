@@ -0,0 +1,84 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_SpendingAnalytics_success(t *testing.T) {
+	start := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002"} {
+		account, err := svc.RegisterAccount(phone)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = svc.Deposit(account.ID, 10_000_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	for i := 1; i <= 10; i++ {
+		clock.Advance(time.Hour)
+
+		_, err := svc.Pay(1, types.Money(i*10_00), "megafon")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	rejected, err := svc.Pay(2, 500_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(rejected.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(2, 50_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	report := svc.SpendingAnalytics(AnalyticsQuery{Goroutines: 3})
+	if len(report.Global) != 2 {
+		t.Errorf("\ngot > %v \nwant > 2 categories", report.Global)
+		return
+	}
+
+	auto, megafon := report.Global[0], report.Global[1]
+	if auto.Count != 1 || auto.Total != 50_00 {
+		t.Errorf("\ngot > %+v \nwant > rejected payment is not counted", auto)
+	}
+
+	want := CategoryStats{Category: "megafon", Count: 10, Total: 550_00, Average: 55_00, P50: 50_00, P90: 90_00, P99: 100_00}
+	if megafon != want {
+		t.Errorf("\ngot > %+v \nwant > %+v", megafon, want)
+	}
+
+	stats, err := svc.AccountSpending(1, AnalyticsQuery{From: start.Add(6 * time.Hour), Goroutines: 2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(stats) != 1 || stats[0].Count != 5 || stats[0].Total != 400_00 {
+		t.Errorf("\ngot > %+v \nwant > 5 payments with total 40000", stats)
+	}
+}
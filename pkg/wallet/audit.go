@@ -0,0 +1,383 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// DefaultActor is used in audit entries when actor is not set
+const DefaultActor = "system"
+
+// Errors of audit trail
+var (
+	ErrAuditChainBroken = errors.New("audit chain is broken")
+	ErrAuditEntryFormat = errors.New("invalid audit entry")
+)
+
+// AuditEntry represents single change made on the service
+type AuditEntry struct {
+	Seq       uint64
+	Time      time.Time
+	Actor     string
+	Operation string
+	AccountID int64
+	Before    types.Money
+	After     types.Money
+	Params    string
+	PrevHash  string
+	Hash      string
+}
+
+// AuditTrail is a hash-chained log of audit entries
+type AuditTrail struct {
+	mu      sync.RWMutex
+	entries []AuditEntry
+}
+
+// Entries returns copy of all entries of the trail
+func (a *AuditTrail) Entries() []AuditEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return append([]AuditEntry(nil), a.entries...)
+}
+
+// Verify walks the chain and returns index of the first broken entry
+func (a *AuditTrail) Verify() (int, error) {
+	return VerifyAudit(a.Entries())
+}
+
+func (a *AuditTrail) append(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.entries) != 0 {
+		entry.PrevHash = a.entries[len(a.entries)-1].Hash
+	}
+
+	entry.Hash = auditHash(entry)
+	a.entries = append(a.entries, entry)
+}
+
+// SetAuditTrail makes service record every change into trail
+func (s *Service) SetAuditTrail(trail *AuditTrail) {
+	s.audit = trail
+}
+
+// SetActor sets who is responsible for the following changes
+func (s *Service) SetActor(actor string) {
+	s.actor = actor
+}
+
+func (s *Service) auditBalances(event Event) map[int64]types.Money {
+	if s.audit == nil {
+		return nil
+	}
+
+	balances := make(map[int64]types.Money)
+	for _, accountID := range eventAccounts(event) {
+		if account, err := s.FindAccountByID(accountID); err == nil {
+			balances[accountID] = account.Balance
+		}
+	}
+
+	return balances
+}
+
+func (s *Service) auditRecord(record Record, before map[int64]types.Money) {
+	if s.audit == nil {
+		return
+	}
+
+	actor := s.actor
+	if actor == "" {
+		actor = DefaultActor
+	}
+
+	for _, accountID := range eventAccounts(record.Event) {
+		entry := AuditEntry{
+			Seq:       record.Seq,
+			Time:      record.Time,
+			Actor:     actor,
+			Operation: record.Event.EventType(),
+			AccountID: accountID,
+			Before:    before[accountID],
+			Params:    fmt.Sprintf("%+v", record.Event),
+		}
+
+		if account, err := s.FindAccountByID(accountID); err == nil {
+			entry.After = account.Balance
+		}
+
+		s.audit.append(entry)
+	}
+}
+
+// eventAccounts returns ids of accounts affected by the event
+func eventAccounts(event Event) []int64 {
+	switch event := event.(type) {
+	case AccountRegistered:
+		return []int64{event.Account.ID}
+	case Deposited:
+		return []int64{event.AccountID}
+	case PaymentCreated:
+		return []int64{event.Payment.AccountID}
+	case PaymentRejected:
+		return withSettlement(event.AccountID, event.SettlementAccountID)
+	case FavoriteCreated:
+		return []int64{event.Favorite.AccountID}
+	case AccountImported:
+		return []int64{event.Account.ID}
+	case PaymentImported:
+		return []int64{event.Payment.AccountID}
+	case FavoriteImported:
+		return []int64{event.Favorite.AccountID}
+	case PaymentHeld:
+		return []int64{event.AccountID}
+	case PaymentCompleted:
+		return withSettlement(event.AccountID, event.SettlementAccountID)
+	case AccountStatusChanged:
+		return []int64{event.AccountID}
+	case Transferred:
+		return []int64{event.FromAccountID, event.ToAccountID}
+	case HoldAuthorized:
+		return []int64{event.Hold.AccountID}
+	case HoldCaptured:
+		return []int64{event.AccountID}
+	case HoldReleased:
+		return []int64{event.AccountID}
+	case RewardAccrued:
+		return []int64{event.AccountID}
+	case RewardClawedBack:
+		return []int64{event.AccountID}
+	case RewardRedeemed:
+		return []int64{event.AccountID}
+	case PromoImported:
+		return []int64{event.AccountID}
+	case PromoRedeemed:
+		return []int64{event.AccountID}
+	case RewardForfeited:
+		return []int64{event.AccountID}
+	case BonusForfeited:
+		return []int64{event.AccountID}
+	case WithdrawalRequested:
+		return []int64{event.Withdrawal.AccountID}
+	case WithdrawalSent:
+		return []int64{event.AccountID}
+	case WithdrawalFailed:
+		return []int64{event.AccountID}
+	case PaymentRequested:
+		return []int64{event.Request.AccountID}
+	case PaymentRequestResolved:
+		return []int64{event.AccountID}
+	case BillSplit:
+		return []int64{event.Split.AccountID}
+	case PocketCreated:
+		return []int64{event.Pocket.AccountID}
+	case PocketMoved:
+		return []int64{event.AccountID}
+	case PocketGoalSet:
+		return []int64{event.AccountID}
+	case PocketDeleted:
+		return []int64{event.AccountID}
+	case PocketImported:
+		return []int64{event.Pocket.AccountID}
+	}
+
+	return nil
+}
+
+// withSettlement returns account of payment and settlement account if payment is settled
+func withSettlement(accountID, settlementAccountID int64) []int64 {
+	if settlementAccountID == 0 {
+		return []int64{accountID}
+	}
+
+	return []int64{accountID, settlementAccountID}
+}
+
+func auditLine(entry AuditEntry) string {
+	return strconv.FormatUint(entry.Seq, 10) + ";" + strconv.FormatInt(entry.Time.UnixNano(), 10) + ";" +
+		strconv.Quote(entry.Actor) + ";" + entry.Operation + ";" + strconv.FormatInt(entry.AccountID, 10) + ";" +
+		strconv.FormatInt(int64(entry.Before), 10) + ";" + strconv.FormatInt(int64(entry.After), 10) + ";" +
+		strconv.Quote(entry.Params) + ";" + entry.PrevHash
+}
+
+func auditHash(entry AuditEntry) string {
+	sum := sha256.Sum256([]byte(auditLine(entry)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAudit walks the chain and returns index of the first broken entry, or -1 if chain is intact
+func VerifyAudit(entries []AuditEntry) (int, error) {
+	prevHash := ""
+	for index, entry := range entries {
+		if entry.PrevHash != prevHash || entry.Hash != auditHash(entry) {
+			return index, ErrAuditChainBroken
+		}
+
+		prevHash = entry.Hash
+	}
+
+	return -1, nil
+}
+
+// WriteAuditToFile is a helper function to write audit entries to respective file
+func WriteAuditToFile(filePath string, entries []AuditEntry) error {
+	var data strings.Builder
+	for _, entry := range entries {
+		data.WriteString(auditLine(entry) + ";" + entry.Hash + "\n")
+	}
+
+	err := ioutil.WriteFile(filePath, []byte(data.String()), 0666)
+	if err != nil {
+		log.Print(err)
+	}
+
+	return err
+}
+
+// ReadAuditFromFile reads audit entries written by WriteAuditToFile
+func ReadAuditFromFile(filePath string) ([]AuditEntry, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrFileNotFound
+		}
+
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	for _, line := range strings.Split(string(content), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+
+		entry, err := parseAuditLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func parseAuditLine(line string) (AuditEntry, error) {
+	entry := AuditEntry{}
+
+	// actor and params are quoted, so they are read separately from the rest of the fields
+	seq, rest, ok := splitField(line)
+	if !ok {
+		return entry, ErrAuditEntryFormat
+	}
+
+	created, rest, ok := splitField(rest)
+	if !ok {
+		return entry, ErrAuditEntryFormat
+	}
+
+	actor, rest, ok := splitQuoted(rest)
+	if !ok {
+		return entry, ErrAuditEntryFormat
+	}
+
+	words := strings.SplitN(rest, ";", 5)
+	if len(words) != 5 {
+		return entry, ErrAuditEntryFormat
+	}
+
+	params, rest, ok := splitQuoted(words[4])
+	if !ok {
+		return entry, ErrAuditEntryFormat
+	}
+
+	hashes := strings.Split(rest, ";")
+	if len(hashes) != 2 {
+		return entry, ErrAuditEntryFormat
+	}
+
+	var err error
+	if entry.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+		return entry, ErrAuditEntryFormat
+	}
+
+	nanos, err := strconv.ParseInt(created, 10, 64)
+	if err != nil {
+		return entry, ErrAuditEntryFormat
+	}
+
+	if entry.AccountID, err = strconv.ParseInt(words[1], 10, 64); err != nil {
+		return entry, ErrAuditEntryFormat
+	}
+
+	before, err := strconv.ParseInt(words[2], 10, 64)
+	if err != nil {
+		return entry, ErrAuditEntryFormat
+	}
+
+	after, err := strconv.ParseInt(words[3], 10, 64)
+	if err != nil {
+		return entry, ErrAuditEntryFormat
+	}
+
+	entry.Time = time.Unix(0, nanos)
+	entry.Actor = actor
+	entry.Operation = words[0]
+	entry.Before = types.Money(before)
+	entry.After = types.Money(after)
+	entry.Params = params
+	entry.PrevHash = hashes[0]
+	entry.Hash = hashes[1]
+
+	return entry, nil
+}
+
+func splitField(line string) (string, string, bool) {
+	index := strings.Index(line, ";")
+	if index < 0 {
+		return "", "", false
+	}
+
+	return line[:index], line[index+1:], true
+}
+
+func splitQuoted(line string) (string, string, bool) {
+	if len(line) == 0 || line[0] != '"' {
+		return "", "", false
+	}
+
+	for index := 1; index < len(line); index++ {
+		switch line[index] {
+		case '\\':
+			index++
+		case '"':
+			if index+1 == len(line) || line[index+1] != ';' {
+				return "", "", false
+			}
+
+			value, err := strconv.Unquote(line[:index+1])
+			if err != nil {
+				return "", "", false
+			}
+
+			return value, line[index+2:], true
+		}
+	}
+
+	return "", "", false
+}
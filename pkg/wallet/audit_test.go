@@ -0,0 +1,94 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_AuditTrail_success(t *testing.T) {
+	svc := &Service{}
+	trail := &AuditTrail{}
+	svc.SetAuditTrail(trail)
+	svc.SetActor("operator")
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 30_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	entries := trail.Entries()
+	if len(entries) != 3 {
+		t.Errorf("\ngot > %v \nwant > 3 entries", len(entries))
+		return
+	}
+
+	payment := entries[2]
+	if payment.Actor != "operator" || payment.Before != 100_00 || payment.After != 70_00 {
+		t.Errorf("\ngot > %+v \nwant > payment from 10000 to 7000", payment)
+	}
+
+	index, err := trail.Verify()
+	if err != nil || index != -1 {
+		t.Errorf("\ngot > %v %v \nwant > -1 nil", index, err)
+	}
+}
+
+func TestVerifyAudit_tampered(t *testing.T) {
+	svc := &Service{}
+	trail := &AuditTrail{}
+	svc.SetAuditTrail(trail)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		err = svc.Deposit(account.ID, 100_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	path := t.TempDir() + "/audit.dump"
+
+	err = WriteAuditToFile(path, trail.Entries())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	entries, err := ReadAuditFromFile(path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	index, err := VerifyAudit(entries)
+	if err != nil || index != -1 {
+		t.Errorf("\ngot > %v %v \nwant > -1 nil", index, err)
+	}
+
+	entries[2].After = types.Money(1_000_000_00)
+
+	index, err = VerifyAudit(entries)
+	if err != ErrAuditChainBroken || index != 2 {
+		t.Errorf("\ngot > %v %v \nwant > 2 %v", index, err, ErrAuditChainBroken)
+	}
+}
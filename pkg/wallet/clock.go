@@ -0,0 +1,87 @@
+package wallet
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Clock provides current time to the service
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock returns real current time
+type SystemClock struct{}
+
+// Now returns current local time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// ManualClock returns time which is changed only explicitly, it is useful for tests
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock creates clock stopped at given time
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns current time of the clock
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Set moves clock to given time
+func (c *ManualClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+// Advance moves clock forward by given duration
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// SetClock replaces clock used to timestamp changes of the service
+func (s *Service) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+func (s *Service) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+
+	return s.clock.Now()
+}
+
+// formatTime is used to store time in dump files, zero time is stored as 0
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// parseTime reads time stored by formatTime, old dumps without timestamps give zero time
+func parseTime(word string) time.Time {
+	nanos, err := strconv.ParseInt(word, 10, 64)
+	if err != nil || nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
+}
@@ -0,0 +1,139 @@
+package wallet
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestService_Timestamps_success(t *testing.T) {
+	created := time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC)
+	clock := NewManualClock(created)
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(time.Hour)
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(time.Hour)
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !account.CreatedAt.Equal(created) || !account.UpdatedAt.Equal(created.Add(2*time.Hour)) {
+		t.Errorf("\ngot > %v %v \nwant > %v %v", account.CreatedAt, account.UpdatedAt, created, created.Add(2*time.Hour))
+	}
+
+	if !payment.CreatedAt.Equal(created.Add(time.Hour)) || !payment.UpdatedAt.Equal(created.Add(2*time.Hour)) {
+		t.Errorf("\ngot > %v %v \nwant > %v %v", payment.CreatedAt, payment.UpdatedAt, created.Add(time.Hour), created.Add(2*time.Hour))
+	}
+}
+
+func TestService_Timestamps_exportImport(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	favorite, err := svc.FavoritePayment(payment.ID, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gotPayment, err := imported.FindPaymentByID(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	gotFavorite, err := imported.FindFavoriteByID(favorite.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !gotPayment.CreatedAt.Equal(payment.CreatedAt) || !gotFavorite.UpdatedAt.Equal(favorite.UpdatedAt) {
+		t.Errorf("\ngot > %v %v \nwant > %v %v", gotPayment.CreatedAt, gotFavorite.UpdatedAt, payment.CreatedAt, favorite.UpdatedAt)
+	}
+}
+
+func TestService_Timestamps_oldDump(t *testing.T) {
+	svc := &Service{}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = svc.Import(wd + "/test2")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.FindAccountByID(2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if account.Balance != 20000 || !account.CreatedAt.IsZero() {
+		t.Errorf("\ngot > %+v \nwant > balance 20000 without timestamps", account)
+	}
+}
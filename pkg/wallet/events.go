@@ -0,0 +1,453 @@
+package wallet
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Event is implemented by every domain event published by Service
+type Event interface {
+	EventType() string
+}
+
+// AccountRegistered is published when new account is registered
+type AccountRegistered struct {
+	Account types.Account
+}
+
+// EventType returns name of the event
+func (AccountRegistered) EventType() string { return "AccountRegistered" }
+
+// Deposited is published when money is deposited to account
+type Deposited struct {
+	AccountID int64
+	Amount    types.Money
+}
+
+// EventType returns name of the event
+func (Deposited) EventType() string { return "Deposited" }
+
+// PaymentCreated is published when new payment is created, Bonus is part of amount paid from bonus balance
+// and Pocket is pocket of account which pays the rest of amount
+type PaymentCreated struct {
+	Payment types.Payment
+	Bonus   types.Money
+	Pocket  string
+}
+
+// EventType returns name of the event
+func (PaymentCreated) EventType() string { return "PaymentCreated" }
+
+// PaymentRejected is published when payment is rejected and its amount is returned to account,
+// settled amount is taken back from settlement account. Bonus part of amount is returned to bonus balance
+// and the rest of amount is returned to Pocket
+type PaymentRejected struct {
+	PaymentID           string
+	AccountID           int64
+	Amount              types.Money
+	SettlementAccountID int64
+	Bonus               types.Money
+	Pocket              string
+}
+
+// EventType returns name of the event
+func (PaymentRejected) EventType() string { return "PaymentRejected" }
+
+// FavoriteCreated is published when new favorite payment is created
+type FavoriteCreated struct {
+	Favorite types.Favorite
+}
+
+// EventType returns name of the event
+func (FavoriteCreated) EventType() string { return "FavoriteCreated" }
+
+// AccountImported is published for every account read by Import or ImportFromFile
+type AccountImported struct {
+	Account types.Account
+	// PayoutAccountID is set for account closed with payout, it receives refunds of failed withdrawals
+	PayoutAccountID int64
+	// Bonus is bonus balance of the account
+	Bonus types.Money
+}
+
+// EventType returns name of the event
+func (AccountImported) EventType() string { return "AccountImported" }
+
+// PaymentImported is published for every payment read by Import
+type PaymentImported struct {
+	Payment types.Payment
+	// SettlementAccountID is set for payments which were settled to merchant account
+	SettlementAccountID int64
+	// Bonus is part of amount which was paid from bonus balance
+	Bonus types.Money
+	// Pocket is name of pocket the payment was paid from, rejected payment returns there
+	Pocket string
+}
+
+// EventType returns name of the event
+func (PaymentImported) EventType() string { return "PaymentImported" }
+
+// FavoriteImported is published for every favorite read by Import
+type FavoriteImported struct {
+	Favorite types.Favorite
+}
+
+// EventType returns name of the event
+func (FavoriteImported) EventType() string { return "FavoriteImported" }
+
+// PaymentHeld is published when risk checker holds payment for manual review
+type PaymentHeld struct {
+	PaymentID string
+	AccountID int64
+	Reasons   []string
+}
+
+// EventType returns name of the event
+func (PaymentHeld) EventType() string { return "PaymentHeld" }
+
+// PaymentCompleted is published when payment is completed, e.g. approved after review.
+// Amount is credited to settlement account when it is not zero
+type PaymentCompleted struct {
+	PaymentID           string
+	AccountID           int64
+	SettlementAccountID int64
+	Amount              types.Money
+}
+
+// EventType returns name of the event
+func (PaymentCompleted) EventType() string { return "PaymentCompleted" }
+
+// AccountStatusChanged is published when account is frozen, unfrozen or closed
+type AccountStatusChanged struct {
+	AccountID int64
+	Status    types.AccountStatus
+	// PayoutAccountID is set when account is closed with payout, it receives refunds of failed withdrawals
+	PayoutAccountID int64
+}
+
+// EventType returns name of the event
+func (AccountStatusChanged) EventType() string { return "AccountStatusChanged" }
+
+// Transferred is published when money is moved from one account to another
+type Transferred struct {
+	FromAccountID int64
+	ToAccountID   int64
+	Amount        types.Money
+}
+
+// EventType returns name of the event
+func (Transferred) EventType() string { return "Transferred" }
+
+// HoldAuthorized is published when funds of account are reserved
+type HoldAuthorized struct {
+	Hold Hold
+}
+
+// EventType returns name of the event
+func (HoldAuthorized) EventType() string { return "HoldAuthorized" }
+
+// HoldCaptured is published when hold is captured, the debit itself is published as PaymentCreated
+type HoldCaptured struct {
+	HoldID    string
+	AccountID int64
+	PaymentID string
+	Amount    types.Money
+}
+
+// EventType returns name of the event
+func (HoldCaptured) EventType() string { return "HoldCaptured" }
+
+// HoldReleased is published when hold is voided or expired
+type HoldReleased struct {
+	HoldID    string
+	AccountID int64
+	Status    HoldStatus
+}
+
+// EventType returns name of the event
+func (HoldReleased) EventType() string { return "HoldReleased" }
+
+// RewardAccrued is published when reward points are accrued for completed payment
+type RewardAccrued struct {
+	AccountID int64
+	PaymentID string
+	Points    int64
+}
+
+// EventType returns name of the event
+func (RewardAccrued) EventType() string { return "RewardAccrued" }
+
+// RewardClawedBack is published when reward points of rejected payment are taken back
+type RewardClawedBack struct {
+	AccountID int64
+	PaymentID string
+	Points    int64
+}
+
+// EventType returns name of the event
+func (RewardClawedBack) EventType() string { return "RewardClawedBack" }
+
+// RewardRedeemed is published when reward points are converted into deposit
+type RewardRedeemed struct {
+	AccountID int64
+	Points    int64
+	Amount    types.Money
+}
+
+// EventType returns name of the event
+func (RewardRedeemed) EventType() string { return "RewardRedeemed" }
+
+// PromoRedeemed is published when bonus of promo code is credited to account
+type PromoRedeemed struct {
+	AccountID int64
+	Code      string
+	Bonus     types.Money
+}
+
+// EventType returns name of the event
+func (PromoRedeemed) EventType() string { return "PromoRedeemed" }
+
+// PromoImported is published for every redeemed promo code read by Import, bonus of the code
+// is counted as spent by the campaign but not credited again, bonus balances are imported with accounts
+type PromoImported struct {
+	AccountID int64
+	Code      string
+	Bonus     types.Money
+}
+
+// EventType returns name of the event
+func (PromoImported) EventType() string { return "PromoImported" }
+
+// RewardForfeited is published when reward points of closed account are written off
+type RewardForfeited struct {
+	AccountID int64
+	Points    int64
+}
+
+// EventType returns name of the event
+func (RewardForfeited) EventType() string { return "RewardForfeited" }
+
+// BonusForfeited is published when bonus balance of closed account is returned to promo campaigns
+type BonusForfeited struct {
+	AccountID int64
+	Amount    types.Money
+}
+
+// EventType returns name of the event
+func (BonusForfeited) EventType() string { return "BonusForfeited" }
+
+// WithdrawalRequested is published when amount of withdrawal is debited from account
+type WithdrawalRequested struct {
+	Withdrawal Withdrawal
+}
+
+// EventType returns name of the event
+func (WithdrawalRequested) EventType() string { return "WithdrawalRequested" }
+
+// WithdrawalSent is published when payout provider accepts withdrawal
+type WithdrawalSent struct {
+	WithdrawalID string
+	AccountID    int64
+	Reference    string
+}
+
+// EventType returns name of the event
+func (WithdrawalSent) EventType() string { return "WithdrawalSent" }
+
+// WithdrawalFailed is published when withdrawal fails and its amount is returned to AccountID,
+// which is payout account when account of the withdrawal was closed with payout
+type WithdrawalFailed struct {
+	WithdrawalID string
+	AccountID    int64
+	Amount       types.Money
+	Reason       string
+}
+
+// EventType returns name of the event
+func (WithdrawalFailed) EventType() string { return "WithdrawalFailed" }
+
+// PaymentRequested is published when account requests money from a phone
+type PaymentRequested struct {
+	Request PaymentRequest
+}
+
+// EventType returns name of the event
+func (PaymentRequested) EventType() string { return "PaymentRequested" }
+
+// PaymentRequestResolved is published when payment request is accepted, declined or expired,
+// money of accepted request is published as Transferred
+type PaymentRequestResolved struct {
+	RequestID string
+	AccountID int64
+	Status    PaymentRequestStatus
+}
+
+// EventType returns name of the event
+func (PaymentRequestResolved) EventType() string { return "PaymentRequestResolved" }
+
+// BillSplit is published when bill is split, before payment requests of its participants
+type BillSplit struct {
+	Split Split
+}
+
+// EventType returns name of the event
+func (BillSplit) EventType() string { return "BillSplit" }
+
+// PocketCreated is published when new pocket of account is created
+type PocketCreated struct {
+	Pocket Pocket
+}
+
+// EventType returns name of the event
+func (PocketCreated) EventType() string { return "PocketCreated" }
+
+// PocketMoved is published when money is moved between pockets of account, empty pocket is the main balance
+type PocketMoved struct {
+	AccountID int64
+	From      string
+	To        string
+	Amount    types.Money
+}
+
+// EventType returns name of the event
+func (PocketMoved) EventType() string { return "PocketMoved" }
+
+// PocketGoalSet is published when savings goal of pocket is changed
+type PocketGoalSet struct {
+	AccountID int64
+	Name      string
+	Goal      types.Money
+}
+
+// EventType returns name of the event
+func (PocketGoalSet) EventType() string { return "PocketGoalSet" }
+
+// PocketDeleted is published when pocket is deleted and its money returns to the main balance
+type PocketDeleted struct {
+	AccountID int64
+	Name      string
+}
+
+// EventType returns name of the event
+func (PocketDeleted) EventType() string { return "PocketDeleted" }
+
+// PocketImported is published for every pocket read by Import
+type PocketImported struct {
+	Pocket Pocket
+}
+
+// EventType returns name of the event
+func (PocketImported) EventType() string { return "PocketImported" }
+
+// EventHandler is called synchronously for every published event
+type EventHandler func(event Event)
+
+// Subscription represents single subscriber of the service events
+type Subscription struct {
+	// C receives events of the channel subscription, it is nil for handler subscriptions
+	C <-chan Event
+
+	bus     *eventBus
+	id      uint64
+	handler EventHandler
+	ch      chan Event
+	dropped uint64
+}
+
+// Unsubscribe stops delivery of events, channel of the subscription is closed
+func (sub *Subscription) Unsubscribe() {
+	sub.bus.remove(sub.id)
+}
+
+// Dropped returns number of events which were not delivered because channel buffer was full
+func (sub *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+type eventBus struct {
+	mu     sync.RWMutex
+	nextID uint64
+	subs   []*Subscription
+}
+
+func (b *eventBus) add(sub *Subscription) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	sub.id = b.nextID
+	sub.bus = b
+	b.subs = append(b.subs, sub)
+
+	return sub
+}
+
+func (b *eventBus) remove(id uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for index, sub := range b.subs {
+		if sub.id == id {
+			if sub.ch != nil {
+				close(sub.ch)
+			}
+
+			b.subs = append(b.subs[:index], b.subs[index+1:]...)
+			return
+		}
+	}
+}
+
+func (b *eventBus) publish(event Event) {
+	b.mu.RLock()
+	handlers := make([]EventHandler, 0, len(b.subs))
+	for _, sub := range b.subs {
+		if sub.handler != nil {
+			handlers = append(handlers, sub.handler)
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+	b.mu.RUnlock()
+
+	// handlers are called outside of the lock, so they are free to unsubscribe
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Subscribe registers handler which is called synchronously for every event published by service
+func (s *Service) Subscribe(handler EventHandler) *Subscription {
+	return s.bus().add(&Subscription{handler: handler})
+}
+
+// SubscribeChan returns subscription with buffered channel receiving events published by service.
+// Publishing never blocks: when buffer is full the event is dropped and counted by Dropped
+func (s *Service) SubscribeChan(buffer int) *Subscription {
+	ch := make(chan Event, buffer)
+
+	return s.bus().add(&Subscription{C: ch, ch: ch})
+}
+
+func (s *Service) bus() *eventBus {
+	if s.events == nil {
+		s.events = &eventBus{}
+	}
+
+	return s.events
+}
+
+func (s *Service) publish(event Event) {
+	if s.events == nil {
+		return
+	}
+
+	s.events.publish(event)
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestService_Subscribe_success(t *testing.T) {
+	svc := &Service{}
+
+	var got []string
+	sub := svc.Subscribe(func(event Event) {
+		got = append(got, event.EventType())
+	})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.FavoritePayment(payment.ID, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want := []string{"AccountRegistered", "Deposited", "PaymentCreated", "FavoriteCreated", "PaymentRejected"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot > %v \nwant > %v", got, want)
+	}
+
+	sub.Unsubscribe()
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("handler was called after Unsubscribe: %v", got)
+	}
+}
+
+func TestService_SubscribeChan_success(t *testing.T) {
+	svc := &Service{}
+	sub := svc.SubscribeChan(1)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	event := <-sub.C
+	registered, ok := event.(AccountRegistered)
+	if !ok || registered.Account.ID != account.ID {
+		t.Errorf("\ngot > %#v \nwant > AccountRegistered", event)
+	}
+
+	if sub.Dropped() != 1 {
+		t.Errorf("\ngot > %v \nwant > 1 dropped event", sub.Dropped())
+	}
+
+	sub.Unsubscribe()
+
+	_, ok = <-sub.C
+	if ok {
+		t.Error("channel must be closed after Unsubscribe")
+	}
+}
@@ -0,0 +1,560 @@
+package wallet
+
+import (
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of event sourcing
+var (
+	ErrEventStoreNotSet    = errors.New("event store is not set")
+	ErrCheckpointNotFound  = errors.New("checkpoint not found")
+	ErrCheckpointTooRecent = errors.New("checkpoint is newer than requested time")
+)
+
+// Record is a single entry of the event log
+type Record struct {
+	Seq   uint64
+	Time  time.Time
+	Event Event
+}
+
+// EventStore keeps ordered log of records
+type EventStore interface {
+	Append(record Record) error
+	Records(afterSeq uint64) ([]Record, error)
+}
+
+// MemoryEventStore keeps event log in memory
+type MemoryEventStore struct {
+	mu      sync.RWMutex
+	records []Record
+}
+
+// Append adds record to the end of the log
+func (m *MemoryEventStore) Append(record Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records = append(m.records, record)
+
+	return nil
+}
+
+// Records returns all records with sequence number greater than afterSeq
+func (m *MemoryEventStore) Records(afterSeq uint64) ([]Record, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Record
+	for _, record := range m.records {
+		if record.Seq > afterSeq {
+			result = append(result, record)
+		}
+	}
+
+	return result, nil
+}
+
+// SetEventStore makes service event-sourced: every following change is appended to the store
+func (s *Service) SetEventStore(store EventStore) {
+	s.eventStore = store
+}
+
+// EventStore returns event store of the service, it is nil unless SetEventStore was called
+func (s *Service) EventStore() EventStore {
+	return s.eventStore
+}
+
+// emit appends event to the event store, applies it to the current state and publishes it.
+// Event which was not appended is not applied and the error is returned
+func (s *Service) emit(event Event) error {
+	return s.emitAt(s.now(), event)
+}
+
+// emitAt is used when event payload is already stamped with given time
+func (s *Service) emitAt(now time.Time, event Event) error {
+	record := Record{Seq: s.seq + 1, Time: now, Event: event}
+
+	if s.eventStore != nil {
+		if err := s.eventStore.Append(record); err != nil {
+			log.Print(err)
+			return err
+		}
+	}
+
+	before := s.auditBalances(event)
+	s.apply(record)
+	s.auditRecord(record, before)
+
+	s.publish(event)
+
+	return nil
+}
+
+// apply is the only place where accounts, payments and favorites are changed
+func (s *Service) apply(record Record) {
+	s.seq = record.Seq
+	s.post(record)
+
+	switch event := record.Event.(type) {
+	case AccountRegistered:
+		account := event.Account
+		s.accounts = append(s.accounts, &account)
+		if account.ID > s.nextAccountID {
+			s.nextAccountID = account.ID
+		}
+	case Deposited:
+		if account, err := s.FindAccountByID(event.AccountID); err == nil {
+			account.Balance += event.Amount
+			account.UpdatedAt = record.Time
+		}
+	case PaymentCreated:
+		if account, err := s.FindAccountByID(event.Payment.AccountID); err == nil {
+			account.Balance -= event.Payment.Amount - event.Bonus
+			account.UpdatedAt = record.Time
+		}
+		if event.Bonus != 0 {
+			s.applyBonus(event.Payment.AccountID, -event.Bonus)
+			if s.paymentBonus == nil {
+				s.paymentBonus = make(map[string]types.Money)
+			}
+			s.paymentBonus[event.Payment.ID] = event.Bonus
+		}
+		if event.Pocket != MainPocket {
+			s.applyPocket(event.Payment.AccountID, event.Pocket, -event.Payment.Amount, record.Time)
+			if s.paymentPockets == nil {
+				s.paymentPockets = make(map[string]string)
+			}
+			s.paymentPockets[event.Payment.ID] = event.Pocket
+		}
+		payment := event.Payment
+		s.payments = append(s.payments, &payment)
+	case PaymentRejected:
+		if payment, err := s.FindPaymentByID(event.PaymentID); err == nil {
+			payment.Status = types.PaymentStatusFail
+			payment.UpdatedAt = record.Time
+		}
+		if account, err := s.FindAccountByID(event.AccountID); err == nil {
+			account.Balance += event.Amount - event.Bonus
+			account.UpdatedAt = record.Time
+		}
+		s.applyBonus(event.AccountID, event.Bonus)
+		delete(s.paymentBonus, event.PaymentID)
+		s.applyPocket(event.AccountID, event.Pocket, event.Amount-event.Bonus, record.Time)
+		delete(s.paymentPockets, event.PaymentID)
+		if account, err := s.FindAccountByID(event.SettlementAccountID); err == nil {
+			account.Balance -= event.Amount
+			account.UpdatedAt = record.Time
+		}
+		delete(s.settlements, event.PaymentID)
+		s.removeHeld(event.PaymentID)
+	case PaymentHeld:
+		s.held = append(s.held, &HeldPayment{PaymentID: event.PaymentID, AccountID: event.AccountID,
+			Reasons: event.Reasons, HeldAt: record.Time})
+	case PaymentCompleted:
+		if payment, err := s.FindPaymentByID(event.PaymentID); err == nil {
+			payment.Status = types.PaymentStatusOk
+			payment.UpdatedAt = record.Time
+		}
+		if account, err := s.FindAccountByID(event.SettlementAccountID); err == nil {
+			account.Balance += event.Amount
+			account.UpdatedAt = record.Time
+			if s.settlements == nil {
+				s.settlements = make(map[string]int64)
+			}
+			s.settlements[event.PaymentID] = account.ID
+		}
+		s.removeHeld(event.PaymentID)
+	case AccountStatusChanged:
+		if account, err := s.FindAccountByID(event.AccountID); err == nil {
+			account.Status = event.Status
+			account.UpdatedAt = record.Time
+		}
+		if event.PayoutAccountID != 0 {
+			if s.payoutAccounts == nil {
+				s.payoutAccounts = make(map[int64]int64)
+			}
+			s.payoutAccounts[event.AccountID] = event.PayoutAccountID
+		}
+	case Transferred:
+		if account, err := s.FindAccountByID(event.FromAccountID); err == nil {
+			account.Balance -= event.Amount
+			account.UpdatedAt = record.Time
+		}
+		if account, err := s.FindAccountByID(event.ToAccountID); err == nil {
+			account.Balance += event.Amount
+			account.UpdatedAt = record.Time
+		}
+	case HoldAuthorized:
+		hold := event.Hold
+		s.holds = append(s.holds, &hold)
+	case HoldCaptured:
+		if hold, err := s.FindHoldByID(event.HoldID); err == nil {
+			hold.Status = HoldStatusCaptured
+			hold.Captured = event.Amount
+			hold.PaymentID = event.PaymentID
+			hold.UpdatedAt = record.Time
+		}
+	case HoldReleased:
+		if hold, err := s.FindHoldByID(event.HoldID); err == nil {
+			hold.Status = event.Status
+			hold.UpdatedAt = record.Time
+		}
+	case RewardAccrued:
+		s.applyReward(RewardEntry{AccountID: event.AccountID, Time: record.Time, Kind: RewardAccrual,
+			PaymentID: event.PaymentID, Points: event.Points})
+	case RewardClawedBack:
+		s.applyReward(RewardEntry{AccountID: event.AccountID, Time: record.Time, Kind: RewardClawback,
+			PaymentID: event.PaymentID, Points: event.Points})
+	case RewardRedeemed:
+		s.applyReward(RewardEntry{AccountID: event.AccountID, Time: record.Time, Kind: RewardRedeem,
+			Points: event.Points, Amount: event.Amount})
+		if account, err := s.FindAccountByID(event.AccountID); err == nil {
+			account.Balance += event.Amount
+			account.UpdatedAt = record.Time
+		}
+	case PromoRedeemed:
+		s.applyPromo(event)
+	case PromoImported:
+		s.applyPromoImport(event)
+	case RewardForfeited:
+		s.applyReward(RewardEntry{AccountID: event.AccountID, Time: record.Time, Kind: RewardForfeit,
+			Points: event.Points})
+	case BonusForfeited:
+		s.applyBonus(event.AccountID, -event.Amount)
+	case PaymentRequested:
+		request := event.Request
+		s.paymentRequests = append(s.paymentRequests, &request)
+	case PaymentRequestResolved:
+		if request, err := s.FindPaymentRequestByID(event.RequestID); err == nil {
+			request.Status = event.Status
+			request.UpdatedAt = record.Time
+		}
+	case BillSplit:
+		split := event.Split
+		s.splits = append(s.splits, &split)
+	case PocketCreated:
+		pocket := event.Pocket
+		s.pockets = append(s.pockets, &pocket)
+	case PocketMoved:
+		s.applyPocket(event.AccountID, event.From, -event.Amount, record.Time)
+		s.applyPocket(event.AccountID, event.To, event.Amount, record.Time)
+	case PocketGoalSet:
+		if pocket, err := s.FindPocket(event.AccountID, event.Name); err == nil {
+			pocket.Goal = event.Goal
+			pocket.UpdatedAt = record.Time
+		}
+	case PocketDeleted:
+		s.removePocket(event.AccountID, event.Name)
+	case PocketImported:
+		if pocket, err := s.FindPocket(event.Pocket.AccountID, event.Pocket.Name); err == nil {
+			*pocket = event.Pocket
+			break
+		}
+		pocket := event.Pocket
+		s.pockets = append(s.pockets, &pocket)
+	case WithdrawalRequested:
+		if account, err := s.FindAccountByID(event.Withdrawal.AccountID); err == nil {
+			account.Balance -= event.Withdrawal.Amount
+			account.UpdatedAt = record.Time
+		}
+		withdrawal := event.Withdrawal
+		s.withdrawals = append(s.withdrawals, &withdrawal)
+	case WithdrawalSent:
+		s.applyWithdrawal(event.WithdrawalID, WithdrawalStatusSent, event.Reference, "", record.Time)
+	case WithdrawalFailed:
+		s.applyWithdrawal(event.WithdrawalID, WithdrawalStatusFailed, "", event.Reason, record.Time)
+		if account, err := s.FindAccountByID(event.AccountID); err == nil {
+			account.Balance += event.Amount
+			account.UpdatedAt = record.Time
+		}
+	case FavoriteCreated:
+		favorite := event.Favorite
+		s.favorites = append(s.favorites, &favorite)
+	case AccountImported:
+		if account, err := s.FindAccountByID(event.Account.ID); err == nil {
+			account.Phone = event.Account.Phone
+			account.Balance = event.Account.Balance
+			account.Status = event.Account.Status
+			account.CreatedAt = event.Account.CreatedAt
+			account.UpdatedAt = event.Account.UpdatedAt
+		} else {
+			account := event.Account
+			s.accounts = append(s.accounts, &account)
+			if account.ID > s.nextAccountID {
+				s.nextAccountID = account.ID
+			}
+		}
+		if event.PayoutAccountID != 0 {
+			if s.payoutAccounts == nil {
+				s.payoutAccounts = make(map[int64]int64)
+			}
+			s.payoutAccounts[event.Account.ID] = event.PayoutAccountID
+		} else {
+			delete(s.payoutAccounts, event.Account.ID)
+		}
+		s.applyBonus(event.Account.ID, event.Bonus-s.bonus[event.Account.ID])
+	case PaymentImported:
+		if payment, err := s.FindPaymentByID(event.Payment.ID); err == nil {
+			payment.AccountID = event.Payment.AccountID
+			payment.Amount = event.Payment.Amount
+			payment.Category = event.Payment.Category
+			payment.Status = event.Payment.Status
+			payment.CreatedAt = event.Payment.CreatedAt
+			payment.UpdatedAt = event.Payment.UpdatedAt
+			payment.ParentID = event.Payment.ParentID
+		} else {
+			payment := event.Payment
+			s.payments = append(s.payments, &payment)
+		}
+		if event.SettlementAccountID != 0 {
+			if s.settlements == nil {
+				s.settlements = make(map[string]int64)
+			}
+			s.settlements[event.Payment.ID] = event.SettlementAccountID
+		} else {
+			delete(s.settlements, event.Payment.ID)
+		}
+		if event.Bonus != 0 {
+			if s.paymentBonus == nil {
+				s.paymentBonus = make(map[string]types.Money)
+			}
+			s.paymentBonus[event.Payment.ID] = event.Bonus
+		} else {
+			delete(s.paymentBonus, event.Payment.ID)
+		}
+		if event.Pocket != MainPocket {
+			if s.paymentPockets == nil {
+				s.paymentPockets = make(map[string]string)
+			}
+			s.paymentPockets[event.Payment.ID] = event.Pocket
+		} else {
+			delete(s.paymentPockets, event.Payment.ID)
+		}
+	case FavoriteImported:
+		if favorite, err := s.FindFavoriteByID(event.Favorite.ID); err == nil {
+			favorite.AccountID = event.Favorite.AccountID
+			favorite.Name = event.Favorite.Name
+			favorite.Amount = event.Favorite.Amount
+			favorite.Category = event.Favorite.Category
+			favorite.CreatedAt = event.Favorite.CreatedAt
+			favorite.UpdatedAt = event.Favorite.UpdatedAt
+			break
+		}
+		favorite := event.Favorite
+		s.favorites = append(s.favorites, &favorite)
+	}
+}
+
+// replay applies records which happened not later than until, zero until means all records
+func (s *Service) replay(records []Record, until time.Time) {
+	for _, record := range records {
+		if !until.IsZero() && record.Time.After(until) {
+			break
+		}
+
+		s.apply(record)
+	}
+}
+
+// Rebuild creates new service as a projection of all records of the store up to given time.
+// Zero until rebuilds current state
+func Rebuild(store EventStore, until time.Time) (*Service, error) {
+	records, err := store.Records(0)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &Service{}
+	svc.replay(records, until)
+
+	return svc, nil
+}
+
+// At returns state of the service as it was at given time
+func (s *Service) At(until time.Time) (*Service, error) {
+	if s.eventStore == nil {
+		return nil, ErrEventStoreNotSet
+	}
+
+	return Rebuild(s.eventStore, until)
+}
+
+// projection is the whole state built by apply, Checkpoint saves it with encoding/gob
+type projection struct {
+	NextAccountID    int64
+	Accounts         []*types.Account
+	Payments         []*types.Payment
+	Favorites        []*types.Favorite
+	Held             []*HeldPayment
+	Holds            []*Hold
+	Journal          []JournalEntry
+	Settlements      map[string]int64
+	RewardPoints     map[int64]int64
+	RewardedPayments map[string]int64
+	RewardHistory    []RewardEntry
+	PromoSpent       map[string]types.Money
+	PromoRedeemed    map[promoKey]types.Money
+	Bonus            map[int64]types.Money
+	PaymentBonus     map[string]types.Money
+	Withdrawals      []*Withdrawal
+	PayoutAccounts   map[int64]int64
+	PaymentRequests  []*PaymentRequest
+	Splits           []*Split
+	Pockets          []*Pocket
+	PaymentPockets   map[string]string
+}
+
+func (s *Service) projection() projection {
+	return projection{
+		NextAccountID:    s.nextAccountID,
+		Accounts:         s.accounts,
+		Payments:         s.payments,
+		Favorites:        s.favorites,
+		Held:             s.held,
+		Holds:            s.holds,
+		Journal:          s.journal,
+		Settlements:      s.settlements,
+		RewardPoints:     s.rewardPoints,
+		RewardedPayments: s.rewardedPayments,
+		RewardHistory:    s.rewardHistory,
+		PromoSpent:       s.promoSpent,
+		PromoRedeemed:    s.promoRedeemed,
+		Bonus:            s.bonus,
+		PaymentBonus:     s.paymentBonus,
+		Withdrawals:      s.withdrawals,
+		PayoutAccounts:   s.payoutAccounts,
+		PaymentRequests:  s.paymentRequests,
+		Splits:           s.splits,
+		Pockets:          s.pockets,
+		PaymentPockets:   s.paymentPockets,
+	}
+}
+
+func (s *Service) restoreProjection(p projection) {
+	s.nextAccountID = p.NextAccountID
+	s.accounts = p.Accounts
+	s.payments = p.Payments
+	s.favorites = p.Favorites
+	s.held = p.Held
+	s.holds = p.Holds
+	s.journal = p.Journal
+	s.settlements = p.Settlements
+	s.rewardPoints = p.RewardPoints
+	s.rewardedPayments = p.RewardedPayments
+	s.rewardHistory = p.RewardHistory
+	s.promoSpent = p.PromoSpent
+	s.promoRedeemed = p.PromoRedeemed
+	s.bonus = p.Bonus
+	s.paymentBonus = p.PaymentBonus
+	s.withdrawals = p.Withdrawals
+	s.payoutAccounts = p.PayoutAccounts
+	s.paymentRequests = p.PaymentRequests
+	s.splits = p.Splits
+	s.pockets = p.Pockets
+	s.paymentPockets = p.PaymentPockets
+}
+
+// Checkpoint exports current state to dir like Export and saves the whole projection to projection.gob
+// together with the sequence number of the last applied record, so the state can be restored without replaying the whole log
+func (s *Service) Checkpoint(dir string) error {
+	err := s.Export(dir)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(dir + "/projection.gob")
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	err = gob.NewEncoder(file).Encode(s.projection())
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	data := strconv.FormatUint(s.seq, 10) + ";" + strconv.FormatInt(s.now().UnixNano(), 10)
+
+	err = ioutil.WriteFile(dir+"/checkpoint.dump", []byte(data), 0666)
+	if err != nil {
+		log.Print(err)
+	}
+
+	return err
+}
+
+// RestoreFromCheckpoint loads projection saved by Checkpoint and replays records of the store
+// which were appended after the checkpoint and not later than until
+func RestoreFromCheckpoint(dir string, store EventStore, until time.Time) (*Service, error) {
+	content, err := ioutil.ReadFile(dir + "/checkpoint.dump")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrCheckpointNotFound
+		}
+
+		return nil, err
+	}
+
+	words := strings.Split(string(content), ";")
+	if len(words) != 2 {
+		return nil, ErrCheckpointNotFound
+	}
+
+	seq, err := strconv.ParseUint(words[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := strconv.ParseInt(words[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	if !until.IsZero() && until.Before(time.Unix(0, created)) {
+		return nil, ErrCheckpointTooRecent
+	}
+
+	file, err := os.Open(dir + "/projection.gob")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrCheckpointNotFound
+		}
+
+		return nil, err
+	}
+	defer file.Close()
+
+	var p projection
+	err = gob.NewDecoder(file).Decode(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &Service{}
+	svc.restoreProjection(p)
+
+	records, err := store.Records(seq)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.seq = seq
+	svc.replay(records, until)
+
+	return svc, nil
+}
@@ -0,0 +1,338 @@
+package wallet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRebuild_success(t *testing.T) {
+	svc := &Service{}
+	svc.SetEventStore(&MemoryEventStore{})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	middle := time.Now()
+
+	payment, err := svc.Pay(account.ID, 30_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.FavoritePayment(payment.ID, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rebuilt, err := Rebuild(svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(rebuilt.accounts, svc.accounts) ||
+		!reflect.DeepEqual(rebuilt.payments, svc.payments) ||
+		!reflect.DeepEqual(rebuilt.favorites, svc.favorites) {
+		t.Errorf("\ngot > %v \nwant > %v", rebuilt.accounts, svc.accounts)
+	}
+
+	past, err := svc.At(middle)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	pastAccount, err := past.FindAccountByID(account.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if pastAccount.Balance != 100_00 || len(past.payments) != 0 {
+		t.Errorf("\ngot > %v \nwant > 10000", pastAccount.Balance)
+	}
+}
+
+func TestService_At_withoutStore(t *testing.T) {
+	svc := &Service{}
+
+	_, err := svc.At(time.Now())
+	if err != ErrEventStoreNotSet {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrEventStoreNotSet)
+	}
+}
+
+func TestRestoreFromCheckpoint_success(t *testing.T) {
+	svc := &Service{}
+	svc.SetEventStore(&MemoryEventStore{})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 30_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+
+	err = svc.Checkpoint(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 5_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	restored, err := RestoreFromCheckpoint(dir, svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	restoredAccount, err := restored.FindAccountByID(account.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if restoredAccount.Balance != 75_00 || len(restored.payments) != 1 {
+		t.Errorf("\ngot > %v \nwant > 7500", restoredAccount.Balance)
+	}
+}
+
+func TestRestoreFromCheckpoint_fullProjection(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+	svc := &Service{}
+	svc.SetClock(clock)
+	svc.SetEventStore(&MemoryEventStore{})
+	svc.SetPayoutProvider(&FakePayoutProvider{})
+	svc.SetRewardRules(RewardRule{BasisPoints: 100})
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 5_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	merchant, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.RegisterMerchant(Merchant{Category: "megafon", Name: "Мегафон", SettlementAccountID: merchant.ID})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.DepositWithPromo(account.ID, 200_00, "welcome")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Authorize(account.ID, 80_00, "hotel", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 20_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Settle(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.CreatePocket(account.ID, "savings", 50_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.MovePocketFunds(account.ID, MainPocket, "savings", 30_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Withdraw(account.ID, 10_00, Destination{Kind: DestinationCard, Number: "4111111111111111"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.RequestPayment(account.ID, merchant.Phone, 5_00, "", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+
+	err = svc.Checkpoint(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(time.Minute)
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	restored, err := RestoreFromCheckpoint(dir, svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rebuilt, err := Rebuild(svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, id := range []int64{account.ID, merchant.ID} {
+		for name, state := range map[string]*Service{"restored": restored, "rebuilt": rebuilt} {
+			state.SetClock(clock)
+
+			got, _ := state.AvailableBalance(id)
+			want, _ := svc.AvailableBalance(id)
+			gotBonus, _ := state.BonusBalance(id)
+			wantBonus, _ := svc.BonusBalance(id)
+			gotPoints, _ := state.RewardBalance(id)
+			wantPoints, _ := svc.RewardBalance(id)
+			if got != want || gotBonus != wantBonus || gotPoints != wantPoints {
+				t.Errorf("%s account %d: \ngot > %v, %v, %v \nwant > %v, %v, %v", name, id, got, gotBonus, gotPoints, want, wantBonus, wantPoints)
+			}
+
+			gotPockets, _ := state.Pockets(id)
+			gotWithdrawals, _ := state.Withdrawals(id)
+			gotOutgoing, _, _ := state.PaymentRequests(id)
+			wantPockets, _ := svc.Pockets(id)
+			wantWithdrawals, _ := svc.Withdrawals(id)
+			wantOutgoing, _, _ := svc.PaymentRequests(id)
+			if len(gotPockets) != len(wantPockets) || len(gotWithdrawals) != len(wantWithdrawals) || len(gotOutgoing) != len(wantOutgoing) {
+				t.Errorf("%s account %d: \ngot > %v, %v, %v \nwant > %v, %v, %v", name, id,
+					gotPockets, gotWithdrawals, gotOutgoing, wantPockets, wantWithdrawals, wantOutgoing)
+			}
+		}
+	}
+
+	if len(restored.Journal()) != len(rebuilt.Journal()) || restored.PromoSpent("welcome") != rebuilt.PromoSpent("welcome") {
+		t.Errorf("\ngot > %v entries \nwant > %v entries", len(restored.Journal()), len(rebuilt.Journal()))
+	}
+
+	if _, err := restored.DepositWithPromo(account.ID, 10_00, "welcome"); err != ErrPromoNotFound {
+		t.Errorf("\ngot > %v \nwant > %v, campaigns are configuration", err, ErrPromoNotFound)
+	}
+
+	err = restored.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// failingEventStore fails to append records while Err is set
+type failingEventStore struct {
+	MemoryEventStore
+	Err error
+}
+
+func (f *failingEventStore) Append(record Record) error {
+	if f.Err != nil {
+		return f.Err
+	}
+
+	return f.MemoryEventStore.Append(record)
+}
+
+func TestService_emit_appendFailed(t *testing.T) {
+	store := &failingEventStore{}
+	svc := &Service{}
+	svc.SetEventStore(store)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	store.Err = errors.New("disk is full")
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != store.Err {
+		t.Errorf("\ngot > %v \nwant > %v", err, store.Err)
+	}
+
+	if account.Balance != 0 || len(svc.Journal()) != 0 {
+		t.Errorf("\ngot > balance %v, %v journal entries \nwant > event is not applied", account.Balance, len(svc.Journal()))
+	}
+
+	store.Err = nil
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rebuilt, err := Rebuild(store, time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	restored, err := rebuilt.FindAccountByID(account.ID)
+	if err != nil || restored.Balance != 100_00 {
+		t.Errorf("\ngot > %v, %v \nwant > balance 10000", restored, err)
+	}
+
+	err = rebuilt.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package wallet
+
+import (
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// FeeCategory is a category of fee payments
+const FeeCategory types.PaymentCategory = "fee"
+
+// AccountTier groups accounts which share fee schedules, empty tier is the default one
+type AccountTier string
+
+// FeeTier is a part of tiered fee schedule applied to amounts up to UpTo, zero UpTo means no upper bound
+type FeeTier struct {
+	UpTo        types.Money
+	Flat        types.Money
+	BasisPoints int64
+}
+
+// FeeSchedule describes fee charged for payment: Flat plus BasisPoints (1% is 100) of amount,
+// clamped to Min and Max. When Tiers are set, Flat and BasisPoints of the first tier which covers amount are used.
+// Zero Max means no upper bound
+type FeeSchedule struct {
+	Flat        types.Money
+	BasisPoints int64
+	Tiers       []FeeTier
+	Min         types.Money
+	Max         types.Money
+}
+
+// Fee returns fee for the amount
+func (f FeeSchedule) Fee(amount types.Money) types.Money {
+	flat, points := f.Flat, f.BasisPoints
+	if len(f.Tiers) != 0 {
+		flat, points = 0, 0
+		for _, tier := range f.Tiers {
+			if tier.UpTo == 0 || amount <= tier.UpTo {
+				flat, points = tier.Flat, tier.BasisPoints
+				break
+			}
+		}
+	}
+
+	fee := flat + amount*types.Money(points)/10_000
+	if fee < f.Min {
+		fee = f.Min
+	}
+
+	if f.Max != 0 && fee > f.Max {
+		fee = f.Max
+	}
+
+	return fee
+}
+
+type feeKey struct {
+	tier     AccountTier
+	category types.PaymentCategory
+}
+
+// SetFeeSchedule sets fee of the category for accounts of the tier.
+// Empty tier matches all tiers and empty category matches all categories, the most specific schedule is used
+func (s *Service) SetFeeSchedule(tier AccountTier, category types.PaymentCategory, schedule FeeSchedule) {
+	if s.feeSchedules == nil {
+		s.feeSchedules = make(map[feeKey]FeeSchedule)
+	}
+
+	s.feeSchedules[feeKey{tier: tier, category: category}] = schedule
+}
+
+// SetAccountTier moves account to the tier
+func (s *Service) SetAccountTier(accountID int64, tier AccountTier) error {
+	_, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+
+	if s.tiers == nil {
+		s.tiers = make(map[int64]AccountTier)
+	}
+
+	s.tiers[accountID] = tier
+
+	return nil
+}
+
+// PaymentFees returns fees charged for the payment
+func (s *Service) PaymentFees(paymentID string) ([]types.Payment, error) {
+	_, err := s.FindPaymentByID(paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var fees []types.Payment
+	for _, fee := range s.fees(paymentID) {
+		fees = append(fees, *fee)
+	}
+
+	return fees, nil
+}
+
+// feeFor returns fee for payment of the account
+func (s *Service) feeFor(accountID int64, amount types.Money, category types.PaymentCategory) types.Money {
+	if len(s.feeSchedules) == 0 {
+		return 0
+	}
+
+	tier := s.tiers[accountID]
+	for _, key := range []feeKey{{tier, category}, {tier, ""}, {"", category}, {"", ""}} {
+		if schedule, ok := s.feeSchedules[key]; ok {
+			return schedule.Fee(amount)
+		}
+	}
+
+	return 0
+}
+
+func (s *Service) fees(paymentID string) []*types.Payment {
+	var fees []*types.Payment
+	for _, payment := range s.payments {
+		if payment.ParentID == paymentID {
+			fees = append(fees, payment)
+		}
+	}
+
+	return fees
+}
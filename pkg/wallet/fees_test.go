@@ -0,0 +1,177 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestFeeSchedule_Fee(t *testing.T) {
+	tiered := FeeSchedule{Tiers: []FeeTier{
+		{UpTo: 100_00, Flat: 1_00},
+		{UpTo: 1000_00, BasisPoints: 100},
+		{BasisPoints: 50},
+	}}
+
+	for _, test := range []struct {
+		schedule FeeSchedule
+		amount   types.Money
+		fee      types.Money
+	}{
+		{FeeSchedule{Flat: 2_00}, 500_00, 2_00},
+		{FeeSchedule{BasisPoints: 150}, 200_00, 3_00},
+		{FeeSchedule{BasisPoints: 100, Min: 5_00}, 100_00, 5_00},
+		{FeeSchedule{Flat: 1_00, BasisPoints: 100, Max: 10_00}, 5000_00, 10_00},
+		{tiered, 50_00, 1_00},
+		{tiered, 500_00, 5_00},
+		{tiered, 4000_00, 20_00},
+	} {
+		if fee := test.schedule.Fee(test.amount); fee != test.fee {
+			t.Errorf("%+v, amount %v: \ngot > %v \nwant > %v", test.schedule, test.amount, fee, test.fee)
+		}
+	}
+}
+
+func TestService_Pay_fee(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	premium, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, id := range []int64{account.ID, premium.ID} {
+		err = svc.Deposit(id, 1000_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	svc.SetFeeSchedule("", "", FeeSchedule{BasisPoints: 100})
+	svc.SetFeeSchedule("premium", "", FeeSchedule{})
+
+	err = svc.SetAccountTier(premium.ID, "premium")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.Pay(account.ID, 995_00, "auto"); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughBalance)
+	}
+
+	payment, err := svc.Pay(account.ID, 200_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(premium.ID, 200_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if account.Balance != 798_00 || premium.Balance != 800_00 {
+		t.Errorf("\ngot > %v, %v \nwant > 79800, 80000", account.Balance, premium.Balance)
+	}
+
+	history, err := svc.ExportAccountHistory(account.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(history) != 2 || history[1].ParentID != payment.ID || history[1].Category != FeeCategory || history[1].Amount != 2_00 {
+		t.Errorf("\ngot > %+v \nwant > payment and its fee", history)
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	fees, err := svc.PaymentFees(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if account.Balance != 1000_00 || len(fees) != 1 || fees[0].Status != types.PaymentStatusFail {
+		t.Errorf("\ngot > balance %v, fees %+v \nwant > fee rejected together with payment", account.Balance, fees)
+	}
+
+	if balance := svc.LedgerBalance(LedgerFees); balance != 0 {
+		t.Errorf("\ngot > %v \nwant > 0", balance)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_Import_fee(t *testing.T) {
+	svc := &Service{}
+	svc.SetFeeSchedule("", "megafon", FeeSchedule{Flat: 50})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	fees, err := imported.PaymentFees(payment.ID)
+	if err != nil || len(fees) != 1 || fees[0].Amount != 50 {
+		t.Errorf("\ngot > %+v, %v \nwant > imported fee", fees, err)
+	}
+
+	err = imported.Settle(fees[0].ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	parent, _ := imported.FindPaymentByID(payment.ID)
+	fee, _ := imported.FindPaymentByID(fees[0].ID)
+	if parent.Status != types.PaymentStatusOk || fee.Status != types.PaymentStatusOk {
+		t.Errorf("\ngot > %v, %v \nwant > both completed", parent.Status, fee.Status)
+	}
+}
@@ -0,0 +1,237 @@
+package wallet
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of holds
+var (
+	ErrHoldNotFound      = errors.New("hold not found")
+	ErrHoldNotActive     = errors.New("hold is not active")
+	ErrHoldExpired       = errors.New("hold is expired")
+	ErrCaptureExceedHold = errors.New("capture amount exceeds hold")
+	ErrAccountHasHolds   = errors.New("account has active holds")
+)
+
+// DefaultHoldTTL is lifetime of hold when Authorize is called with non-positive ttl
+const DefaultHoldTTL = 7 * 24 * time.Hour
+
+// HoldStatus represents state of hold
+type HoldStatus string
+
+// hold statuses
+const (
+	HoldStatusActive   HoldStatus = "ACTIVE"
+	HoldStatusCaptured HoldStatus = "CAPTURED"
+	HoldStatusVoided   HoldStatus = "VOIDED"
+	HoldStatusExpired  HoldStatus = "EXPIRED"
+)
+
+// Hold reserves funds of account until it is captured, voided or expired.
+// Reserved funds stay in account balance but are not available for payments
+type Hold struct {
+	ID        string
+	AccountID int64
+	Amount    types.Money
+	Category  types.PaymentCategory
+	Status    HoldStatus
+	// Captured and PaymentID are set when hold is captured, the rest of Amount is released
+	Captured  types.Money
+	PaymentID string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// reserves tells whether hold still reserves funds at given time
+func (h *Hold) reserves(now time.Time) bool {
+	return h.Status == HoldStatusActive && now.Before(h.ExpiresAt)
+}
+
+// Authorize reserves amount on account without debiting it, hold expires after ttl
+func (s *Service) Authorize(accountID int64, amount types.Money, category types.PaymentCategory, ttl time.Duration) (*Hold, error) {
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAccountStatus(account); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkMerchant(amount, category); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkLimits(account.ID, amount, category); err != nil {
+		return nil, err
+	}
+
+	if s.availableBalance(account) < amount {
+		return nil, ErrNotEnoughBalance
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultHoldTTL
+	}
+
+	now := s.now()
+	err = s.emitAt(now, HoldAuthorized{Hold: Hold{
+		ID:        uuid.New().String(),
+		AccountID: account.ID,
+		Amount:    amount,
+		Category:  category,
+		Status:    HoldStatusActive,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.holds[len(s.holds)-1], nil
+}
+
+// Capture debits amount of active hold and releases the rest of it. Captured payment is checked and charged
+// the same way as Pay: fee is charged, bonus balance is spent first and risk checker may deny or hold it.
+// Captured payment is completed at once unless it is held for review
+func (s *Service) Capture(holdID string, amount types.Money) (*types.Payment, error) {
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	hold, err := s.activeHold(holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	if amount > hold.Amount {
+		return nil, ErrCaptureExceedHold
+	}
+
+	if _, err := s.settlementAccount(hold.Category); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.pay(hold.AccountID, amount, hold.Category, MainPocket, hold)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.findHeld(payment.ID); err == nil {
+		return payment, nil
+	}
+
+	return payment, s.complete(payment)
+}
+
+// Void releases active hold without debiting account
+func (s *Service) Void(holdID string) error {
+	hold, err := s.activeHold(holdID)
+	if err != nil {
+		return err
+	}
+
+	return s.emit(HoldReleased{HoldID: hold.ID, AccountID: hold.AccountID, Status: HoldStatusVoided})
+}
+
+// ExpireHolds marks active holds which are past their expiration time as expired and returns them.
+// Expired holds do not reserve funds even before ExpireHolds is called.
+// Holds expired before an error are returned together with it
+func (s *Service) ExpireHolds() ([]*Hold, error) {
+	now := s.now()
+
+	var expired []*Hold
+	for _, hold := range s.holds {
+		if hold.Status == HoldStatusActive && !hold.reserves(now) {
+			err := s.emitAt(now, HoldReleased{HoldID: hold.ID, AccountID: hold.AccountID, Status: HoldStatusExpired})
+			if err != nil {
+				return expired, err
+			}
+			expired = append(expired, hold)
+		}
+	}
+
+	return expired, nil
+}
+
+// FindHoldByID returns hold by id
+func (s *Service) FindHoldByID(holdID string) (*Hold, error) {
+	for _, hold := range s.holds {
+		if hold.ID == holdID {
+			return hold, nil
+		}
+	}
+
+	return nil, ErrHoldNotFound
+}
+
+// AvailableBalance returns balance of account minus funds reserved by holds and money of pockets
+func (s *Service) AvailableBalance(accountID int64) (types.Money, error) {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.availableBalance(account), nil
+}
+
+func (s *Service) availableBalance(account *types.Account) types.Money {
+	available := account.Balance - s.pocketsBalance(account.ID)
+	if len(s.holds) == 0 {
+		return available
+	}
+
+	now := s.now()
+	for _, hold := range s.holds {
+		if hold.AccountID == account.ID && hold.reserves(now) {
+			available -= hold.Amount
+		}
+	}
+
+	return available
+}
+
+// hasHolds reports whether holds reserve funds of account
+func (s *Service) hasHolds(accountID int64) bool {
+	now := s.now()
+	for _, hold := range s.holds {
+		if hold.AccountID == accountID && hold.reserves(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// activeHold returns hold which can be captured or voided, expired hold is marked as expired
+func (s *Service) activeHold(holdID string) (*Hold, error) {
+	hold, err := s.FindHoldByID(holdID)
+	if err != nil {
+		return nil, err
+	}
+
+	if hold.Status != HoldStatusActive {
+		return nil, ErrHoldNotActive
+	}
+
+	now := s.now()
+	if !hold.reserves(now) {
+		if err := s.emitAt(now, HoldReleased{HoldID: hold.ID, AccountID: hold.AccountID, Status: HoldStatusExpired}); err != nil {
+			return nil, err
+		}
+		return nil, ErrHoldExpired
+	}
+
+	return hold, nil
+}
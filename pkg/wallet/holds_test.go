@@ -0,0 +1,241 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_Capture_partial(t *testing.T) {
+	svc := &Service{}
+	svc.SetClock(NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)))
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := svc.Authorize(account.ID, 70_00, "hotel", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	available, _ := svc.AvailableBalance(account.ID)
+	if account.Balance != 100_00 || available != 30_00 {
+		t.Errorf("\ngot > balance %v, available %v \nwant > balance 10000, available 3000", account.Balance, available)
+	}
+
+	if _, err := svc.Pay(account.ID, 40_00, "auto"); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughBalance)
+	}
+
+	if _, err := svc.Capture(hold.ID, 80_00); err != ErrCaptureExceedHold {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrCaptureExceedHold)
+	}
+
+	payment, err := svc.Capture(hold.ID, 50_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	available, _ = svc.AvailableBalance(account.ID)
+	if payment.Amount != 50_00 || account.Balance != 50_00 || available != 50_00 || hold.Status != HoldStatusCaptured {
+		t.Errorf("\ngot > payment %v, balance %v, available %v, hold %v", payment.Amount, account.Balance, available, hold.Status)
+	}
+
+	if err := svc.Void(hold.ID); err != ErrHoldNotActive {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrHoldNotActive)
+	}
+}
+
+func TestService_Void_success(t *testing.T) {
+	svc := &Service{}
+	svc.SetClock(NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)))
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := svc.Authorize(account.ID, 100_00, "hotel", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.Authorize(account.ID, 1, "hotel", 0); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughBalance)
+	}
+
+	err = svc.Void(hold.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	available, _ := svc.AvailableBalance(account.ID)
+	if available != 100_00 || hold.Status != HoldStatusVoided {
+		t.Errorf("\ngot > available %v, hold %v \nwant > available 10000, hold %v", available, hold.Status, HoldStatusVoided)
+	}
+}
+
+func TestService_ExpireHolds_success(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	first, err := svc.Authorize(account.ID, 40_00, "hotel", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	second, err := svc.Authorize(account.ID, 40_00, "hotel", 2*time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(time.Hour)
+
+	available, _ := svc.AvailableBalance(account.ID)
+	if available != 60_00 {
+		t.Errorf("\ngot > %v \nwant > %v", available, 60_00)
+	}
+
+	expired, err := svc.ExpireHolds()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(expired) != 1 || expired[0] != first || first.Status != HoldStatusExpired {
+		t.Errorf("\ngot > %+v \nwant > first hold expired", expired)
+	}
+
+	clock.Advance(time.Hour)
+
+	if _, err := svc.Capture(second.ID, 40_00); err != ErrHoldExpired {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrHoldExpired)
+	}
+
+	if second.Status != HoldStatusExpired || account.Balance != 100_00 {
+		t.Errorf("\ngot > hold %v, balance %v \nwant > expired hold, untouched balance", second.Status, account.Balance)
+	}
+}
+
+func TestService_Capture_feeAndBonus(t *testing.T) {
+	svc := &Service{}
+	svc.SetClock(NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)))
+	svc.SetFeeSchedule("", "hotel", FeeSchedule{Flat: 1_00})
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 10_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.DepositWithPromo(account.ID, 100_00, "welcome")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := svc.Authorize(account.ID, 100_00, "hotel", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Capture(hold.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bonus, _ := svc.BonusBalance(account.ID)
+	if account.Balance != 9_00 || bonus != 0 {
+		t.Errorf("\ngot > balance %v, bonus %v \nwant > balance 900, bonus 0", account.Balance, bonus)
+	}
+
+	fees, err := svc.PaymentFees(payment.ID)
+	if err != nil || len(fees) != 1 || fees[0].Amount != 1_00 || fees[0].Status != types.PaymentStatusOk {
+		t.Errorf("\ngot > %+v, %v \nwant > completed fee of 100", fees, err)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_Capture_riskDenied(t *testing.T) {
+	svc := &Service{}
+	svc.SetClock(NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)))
+	svc.SetRiskChecker(&RuleEngine{Rules: []RiskRule{
+		NewAccountAmount{MaxAge: 24 * time.Hour, MaxAmount: 50_00, Decision: RiskDeny},
+	}})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := svc.Authorize(account.ID, 70_00, "hotel", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.Capture(hold.ID, 70_00); !errors.Is(err, ErrPaymentDenied) {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPaymentDenied)
+	}
+
+	if hold.Status != HoldStatusActive || account.Balance != 100_00 {
+		t.Errorf("\ngot > hold %v, balance %v \nwant > hold stays active, nothing debited", hold.Status, account.Balance)
+	}
+}
@@ -0,0 +1,267 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of ledger verification
+var (
+	ErrLedgerUnbalanced = errors.New("ledger is unbalanced")
+	ErrLedgerMismatch   = errors.New("account balance does not match ledger")
+)
+
+// ledger accounts which are not wallets of users
+const (
+	// LedgerDeposits is where deposited money comes from, its balance is minus all deposits
+	LedgerDeposits = "external:deposits"
+	// LedgerPayments is where paid money goes to, its balance is all payments which were not refunded
+	LedgerPayments = "external:payments"
+	// LedgerAdjustments balances imported account balances which have no history
+	LedgerAdjustments = "equity:adjustments"
+	// LedgerFees is where charged fees go to
+	LedgerFees = "income:fees"
+	// LedgerRewards is where money of redeemed reward points comes from
+	LedgerRewards = "expense:rewards"
+	// LedgerPromo is where bonus money of promo campaigns comes from
+	LedgerPromo = "expense:promo"
+	// LedgerWithdrawals is where withdrawn money goes to, its balance is all withdrawals which did not fail
+	LedgerWithdrawals = "external:withdrawals"
+)
+
+// walletPrefix is a prefix of ledger accounts of user wallets
+const walletPrefix = "wallet:"
+
+// bonusPrefix is a prefix of ledger accounts of bonus balances
+const bonusPrefix = "bonus:"
+
+// WalletLedgerAccount returns name of the ledger account of the wallet
+func WalletLedgerAccount(accountID int64) string {
+	return walletPrefix + strconv.FormatInt(accountID, 10)
+}
+
+// BonusLedgerAccount returns name of the ledger account of bonus balance of the wallet
+func BonusLedgerAccount(accountID int64) string {
+	return bonusPrefix + strconv.FormatInt(accountID, 10)
+}
+
+// Posting moves amount to the ledger account, positive amount is debit and negative amount is credit
+type Posting struct {
+	Account string
+	Amount  types.Money
+}
+
+// JournalEntry groups postings of one event, amounts of postings sum to zero
+type JournalEntry struct {
+	Seq       uint64
+	Time      time.Time
+	Operation string
+	// PaymentID is set for entries of created and refunded payments
+	PaymentID string
+	Postings  []Posting
+}
+
+// Journal returns all journal entries in order they were posted
+func (s *Service) Journal() []JournalEntry {
+	journal := make([]JournalEntry, len(s.journal))
+	copy(journal, s.journal)
+
+	return journal
+}
+
+// LedgerBalance returns sum of all postings of the ledger account
+func (s *Service) LedgerBalance(account string) types.Money {
+	var balance types.Money
+	for _, entry := range s.journal {
+		for _, posting := range entry.Postings {
+			if posting.Account == account {
+				balance += posting.Amount
+			}
+		}
+	}
+
+	return balance
+}
+
+// TrialBalanceLine is total of one ledger account
+type TrialBalanceLine struct {
+	Account string
+	Debit   types.Money
+	Credit  types.Money
+	Balance types.Money
+}
+
+// TrialBalance lists totals of all ledger accounts, books are balanced when Debit equals Credit
+type TrialBalance struct {
+	Lines  []TrialBalanceLine
+	Debit  types.Money
+	Credit types.Money
+}
+
+// Balanced reports whether all debits are equal to all credits
+func (t *TrialBalance) Balanced() bool {
+	return t.Debit == t.Credit
+}
+
+// TrialBalance sums postings of every ledger account
+func (s *Service) TrialBalance() *TrialBalance {
+	lines := make(map[string]*TrialBalanceLine)
+	trial := &TrialBalance{}
+
+	for _, entry := range s.journal {
+		for _, posting := range entry.Postings {
+			line, ok := lines[posting.Account]
+			if !ok {
+				line = &TrialBalanceLine{Account: posting.Account}
+				lines[posting.Account] = line
+			}
+
+			if posting.Amount > 0 {
+				line.Debit += posting.Amount
+				trial.Debit += posting.Amount
+			} else {
+				line.Credit -= posting.Amount
+				trial.Credit -= posting.Amount
+			}
+			line.Balance += posting.Amount
+		}
+	}
+
+	for _, line := range lines {
+		trial.Lines = append(trial.Lines, *line)
+	}
+
+	sort.Slice(trial.Lines, func(i, j int) bool {
+		return trial.Lines[i].Account < trial.Lines[j].Account
+	})
+
+	return trial
+}
+
+// VerifyLedger checks that every journal entry is balanced and
+// that balance of every account is equal to balance of its ledger account
+func (s *Service) VerifyLedger() error {
+	for _, entry := range s.journal {
+		var sum types.Money
+		for _, posting := range entry.Postings {
+			sum += posting.Amount
+		}
+
+		if sum != 0 {
+			return fmt.Errorf("entry %d %s sums to %d: %w", entry.Seq, entry.Operation, sum, ErrLedgerUnbalanced)
+		}
+	}
+
+	trial := s.TrialBalance()
+	if !trial.Balanced() {
+		return fmt.Errorf("debit %d, credit %d: %w", trial.Debit, trial.Credit, ErrLedgerUnbalanced)
+	}
+
+	balances := make(map[string]types.Money, len(trial.Lines))
+	for _, line := range trial.Lines {
+		balances[line.Account] = line.Balance
+	}
+
+	for _, account := range s.accounts {
+		ledger := balances[WalletLedgerAccount(account.ID)]
+		if account.Balance != ledger {
+			return fmt.Errorf("account %d has %d, ledger has %d: %w", account.ID, account.Balance, ledger, ErrLedgerMismatch)
+		}
+
+		bonus := balances[BonusLedgerAccount(account.ID)]
+		if s.bonus[account.ID] != bonus {
+			return fmt.Errorf("account %d has bonus %d, ledger has %d: %w", account.ID, s.bonus[account.ID], bonus, ErrLedgerMismatch)
+		}
+	}
+
+	for name, balance := range balances {
+		if !strings.HasPrefix(name, walletPrefix) || balance == 0 {
+			continue
+		}
+
+		accountID, _ := strconv.ParseInt(strings.TrimPrefix(name, walletPrefix), 10, 64)
+		if _, err := s.FindAccountByID(accountID); err != nil {
+			return fmt.Errorf("ledger account %s of unknown account has %d: %w", name, balance, ErrLedgerMismatch)
+		}
+	}
+
+	return nil
+}
+
+// post records journal entry of the event, it is called by apply before state is changed
+func (s *Service) post(record Record) {
+	var postings []Posting
+
+	switch event := record.Event.(type) {
+	case Deposited:
+		postings = transfer(LedgerDeposits, WalletLedgerAccount(event.AccountID), event.Amount)
+	case PaymentCreated:
+		to := LedgerPayments
+		if event.Payment.ParentID != "" {
+			to = LedgerFees
+		}
+		postings = transfer(WalletLedgerAccount(event.Payment.AccountID), to, event.Payment.Amount-event.Bonus)
+		postings = append(postings, transfer(BonusLedgerAccount(event.Payment.AccountID), to, event.Bonus)...)
+	case PaymentRejected:
+		from := LedgerPayments
+		if event.SettlementAccountID != 0 {
+			from = WalletLedgerAccount(event.SettlementAccountID)
+		} else if payment, err := s.FindPaymentByID(event.PaymentID); err == nil && payment.ParentID != "" {
+			from = LedgerFees
+		}
+		postings = transfer(from, WalletLedgerAccount(event.AccountID), event.Amount-event.Bonus)
+		postings = append(postings, transfer(from, BonusLedgerAccount(event.AccountID), event.Bonus)...)
+	case PaymentCompleted:
+		if event.SettlementAccountID != 0 {
+			postings = transfer(LedgerPayments, WalletLedgerAccount(event.SettlementAccountID), event.Amount)
+		}
+	case RewardRedeemed:
+		postings = transfer(LedgerRewards, WalletLedgerAccount(event.AccountID), event.Amount)
+	case PromoRedeemed:
+		postings = transfer(LedgerPromo, BonusLedgerAccount(event.AccountID), event.Bonus)
+	case BonusForfeited:
+		postings = transfer(BonusLedgerAccount(event.AccountID), LedgerPromo, event.Amount)
+	case WithdrawalRequested:
+		postings = transfer(WalletLedgerAccount(event.Withdrawal.AccountID), LedgerWithdrawals, event.Withdrawal.Amount)
+	case WithdrawalFailed:
+		postings = transfer(LedgerWithdrawals, WalletLedgerAccount(event.AccountID), event.Amount)
+	case Transferred:
+		postings = transfer(WalletLedgerAccount(event.FromAccountID), WalletLedgerAccount(event.ToAccountID), event.Amount)
+	case AccountImported:
+		var before types.Money
+		if account, err := s.FindAccountByID(event.Account.ID); err == nil {
+			before = account.Balance
+		}
+		// zero adjustment is posted too, it marks opening balance of the account for reconciliation
+		diff := event.Account.Balance - before
+		postings = []Posting{{Account: LedgerAdjustments, Amount: -diff}, {Account: WalletLedgerAccount(event.Account.ID), Amount: diff}}
+		postings = append(postings, transfer(LedgerAdjustments, BonusLedgerAccount(event.Account.ID), event.Bonus-s.bonus[event.Account.ID])...)
+	}
+
+	if len(postings) == 0 {
+		return
+	}
+
+	s.journal = append(s.journal, JournalEntry{
+		Seq:       record.Seq,
+		Time:      record.Time,
+		Operation: record.Event.EventType(),
+		PaymentID: paymentOf(record.Event),
+		Postings:  postings,
+	})
+}
+
+// transfer returns postings which move amount from one ledger account to another
+func transfer(from, to string, amount types.Money) []Posting {
+	if amount == 0 {
+		return nil
+	}
+
+	return []Posting{{Account: from, Amount: -amount}, {Account: to, Amount: amount}}
+}
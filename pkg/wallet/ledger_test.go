@@ -0,0 +1,155 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_TrialBalance_success(t *testing.T) {
+	svc := &Service{}
+
+	first, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	second, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(first.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(first.ID, 30_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.Reject(payment.ID); err != ErrPaymentRejected {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPaymentRejected)
+	}
+
+	_, err = svc.Pay(first.ID, 20_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.CloseAccountWithPayout(first.ID, second.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	trial := svc.TrialBalance()
+	if !trial.Balanced() || trial.Debit != 260_00 {
+		t.Errorf("\ngot > %+v \nwant > balanced books with debit 26000", trial)
+	}
+
+	for account, want := range map[string]types.Money{
+		LedgerDeposits:                 -100_00,
+		LedgerPayments:                 20_00,
+		WalletLedgerAccount(first.ID):  0,
+		WalletLedgerAccount(second.ID): 80_00,
+	} {
+		if balance := svc.LedgerBalance(account); balance != want {
+			t.Errorf("%v: \ngot > %v \nwant > %v", account, balance, want)
+		}
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_VerifyLedger_mismatch(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account.Balance += 1_00
+
+	err = svc.VerifyLedger()
+	if !errors.Is(err, ErrLedgerMismatch) {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrLedgerMismatch)
+	}
+}
+
+func TestService_Journal_import(t *testing.T) {
+	svc := &Service{}
+	svc.SetEventStore(&MemoryEventStore{})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+	account.Balance = 150_00
+
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	account.Balance = 100_00
+
+	err = svc.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if balance := svc.LedgerBalance(LedgerAdjustments); balance != -50_00 {
+		t.Errorf("\ngot > %v \nwant > %v", balance, -50_00)
+	}
+
+	rebuilt, err := Rebuild(svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(rebuilt.Journal()) != len(svc.Journal()) {
+		t.Errorf("\ngot > %v entries \nwant > %v", len(rebuilt.Journal()), len(svc.Journal()))
+	}
+
+	err = rebuilt.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
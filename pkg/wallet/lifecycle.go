@@ -0,0 +1,160 @@
+package wallet
+
+import (
+	"errors"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of account lifecycle
+var (
+	ErrAccountFrozen        = errors.New("account is frozen")
+	ErrAccountClosed        = errors.New("account is closed")
+	ErrAccountNotEmpty      = errors.New("account balance is not zero")
+	ErrInvalidAccountStatus = errors.New("invalid account status")
+	ErrSameAccount          = errors.New("source and destination accounts are the same")
+)
+
+// checkAccountStatus returns error when money can not be moved to or from account
+func checkAccountStatus(account *types.Account) error {
+	switch account.Status {
+	case types.AccountStatusFrozen:
+		return ErrAccountFrozen
+	case types.AccountStatusClosed:
+		return ErrAccountClosed
+	}
+
+	return nil
+}
+
+// FreezeAccount blocks deposits and payments of active account
+func (s *Service) FreezeAccount(accountID int64) error {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkAccountStatus(account); err != nil {
+		return err
+	}
+
+	return s.emit(AccountStatusChanged{AccountID: account.ID, Status: types.AccountStatusFrozen})
+}
+
+// UnfreezeAccount makes frozen account active again
+func (s *Service) UnfreezeAccount(accountID int64) error {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+
+	if account.Status != types.AccountStatusFrozen {
+		return ErrInvalidAccountStatus
+	}
+
+	return s.emit(AccountStatusChanged{AccountID: account.ID, Status: types.AccountStatusActive})
+}
+
+// CloseAccount closes active or frozen account with zero balance, closed account can not be reopened.
+// Bonus balance and reward points of closed account are forfeited.
+// Account with pending withdrawals is closed by CloseAccountWithPayout, which receives their refunds.
+// Sent withdrawal of account closed without payout is refunded to the closed account when it fails
+func (s *Service) CloseAccount(accountID int64) error {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+
+	if account.Status == types.AccountStatusClosed {
+		return ErrAccountClosed
+	}
+
+	if s.hasHolds(account.ID) {
+		return ErrAccountHasHolds
+	}
+
+	if account.Balance != 0 {
+		return ErrAccountNotEmpty
+	}
+
+	if s.hasWithdrawals(account.ID) {
+		return ErrAccountHasWithdrawals
+	}
+
+	if err := s.deletePockets(account.ID); err != nil {
+		return err
+	}
+
+	if err := s.forfeit(account.ID); err != nil {
+		return err
+	}
+
+	return s.emit(AccountStatusChanged{AccountID: account.ID, Status: types.AccountStatusClosed})
+}
+
+// CloseAccountWithPayout transfers remaining balance to another active account and closes the account,
+// withdrawals of the account which fail later are refunded to the payout account.
+// Bonus balance and reward points are not transferred, they are forfeited as by CloseAccount
+func (s *Service) CloseAccountWithPayout(accountID int64, payoutAccountID int64) error {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+
+	if account.Status == types.AccountStatusClosed {
+		return ErrAccountClosed
+	}
+
+	if s.hasHolds(account.ID) {
+		return ErrAccountHasHolds
+	}
+
+	if account.Balance < 0 {
+		return ErrNotEnoughBalance
+	}
+
+	payout, err := s.FindAccountByID(payoutAccountID)
+	if err != nil {
+		return err
+	}
+
+	if payout.ID == account.ID {
+		return ErrSameAccount
+	}
+
+	if err := checkAccountStatus(payout); err != nil {
+		return err
+	}
+
+	if err := s.deletePockets(account.ID); err != nil {
+		return err
+	}
+
+	if err := s.forfeit(account.ID); err != nil {
+		return err
+	}
+
+	if account.Balance > 0 {
+		err = s.emit(Transferred{FromAccountID: account.ID, ToAccountID: payout.ID, Amount: account.Balance})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.emit(AccountStatusChanged{AccountID: account.ID, Status: types.AccountStatusClosed, PayoutAccountID: payout.ID})
+}
+
+// forfeit publishes write-off of bonus balance and reward points of account, e.g. before it is closed
+func (s *Service) forfeit(accountID int64) error {
+	if points := s.rewardPoints[accountID]; points > 0 {
+		if err := s.emit(RewardForfeited{AccountID: accountID, Points: points}); err != nil {
+			return err
+		}
+	}
+
+	if bonus := s.bonus[accountID]; bonus > 0 {
+		return s.emit(BonusForfeited{AccountID: accountID, Amount: bonus})
+	}
+
+	return nil
+}
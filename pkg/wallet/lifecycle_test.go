@@ -0,0 +1,303 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_FreezeAccount_success(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	favorite, err := svc.FavoritePayment(payment.ID, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.FreezeAccount(account.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.Deposit(account.ID, 10_00); err != ErrAccountFrozen {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountFrozen)
+	}
+
+	if _, err := svc.Repeat(payment.ID); err != ErrAccountFrozen {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountFrozen)
+	}
+
+	if _, err := svc.PayFromFavorite(favorite.ID); err != ErrAccountFrozen {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountFrozen)
+	}
+
+	err = svc.UnfreezeAccount(account.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.UnfreezeAccount(account.ID); err != ErrInvalidAccountStatus {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrInvalidAccountStatus)
+	}
+
+	_, err = svc.Repeat(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestService_CloseAccount_success(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payout, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 110_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.CloseAccount(account.ID); err != ErrAccountNotEmpty {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountNotEmpty)
+	}
+
+	err = svc.CloseAccountWithPayout(account.ID, payout.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if account.Status != types.AccountStatusClosed || account.Balance != 0 || payout.Balance != 100_00 {
+		t.Errorf("\ngot > %+v, %+v \nwant > closed account with balance moved to payout", account, payout)
+	}
+
+	if _, err := svc.Pay(account.ID, 1, "auto"); err != ErrAccountClosed {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountClosed)
+	}
+
+	if err := svc.FreezeAccount(account.ID); err != ErrAccountClosed {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountClosed)
+	}
+
+	if err := svc.Reject(payment.ID); err != ErrAccountClosed || account.Balance != 0 {
+		t.Errorf("\ngot > %v, balance %v \nwant > %v, nothing refunded", err, account.Balance, ErrAccountClosed)
+	}
+}
+
+func TestService_Import_accountStatus(t *testing.T) {
+	svc := &Service{}
+
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002", "+992000000003"} {
+		_, err := svc.RegisterAccount(phone)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	err := svc.FreezeAccount(2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.CloseAccount(3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for id, want := range map[int64]types.AccountStatus{
+		1: types.AccountStatusActive,
+		2: types.AccountStatusFrozen,
+		3: types.AccountStatusClosed,
+	} {
+		account, err := imported.FindAccountByID(id)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if account.Status != want {
+			t.Errorf("account %v: \ngot > %v \nwant > %v", id, account.Status, want)
+		}
+	}
+}
+
+func TestService_Import_payoutAccount(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payout, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.CloseAccountWithPayout(account.ID, payout.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if refund := imported.refundAccount(account.ID); refund != payout.ID {
+		t.Errorf("\ngot > %v \nwant > %v", refund, payout.ID)
+	}
+}
+
+func TestService_CloseAccountWithPayout_forfeit(t *testing.T) {
+	svc := &Service{}
+	svc.SetEventStore(&MemoryEventStore{})
+	svc.SetRewardRules(RewardRule{BasisPoints: 100})
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 10_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payout, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 50_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Settle(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.DepositWithPromo(account.ID, 100_00, "welcome")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.CloseAccountWithPayout(account.ID, payout.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bonus, _ := svc.BonusBalance(account.ID)
+	points, _ := svc.RewardBalance(account.ID)
+	if bonus != 0 || points != 0 || payout.Balance != 150_00 {
+		t.Errorf("\ngot > bonus %v, points %v, payout %v \nwant > bonus and points forfeited, 15000 paid out", bonus, points, payout.Balance)
+	}
+
+	history, _ := svc.RewardHistory(account.ID)
+	if len(history) != 2 || history[1].Kind != RewardForfeit || history[1].Points != 50 {
+		t.Errorf("\ngot > %+v \nwant > 50 points forfeited", history)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rebuilt, err := svc.At(time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bonus, _ = rebuilt.BonusBalance(account.ID)
+	points, _ = rebuilt.RewardBalance(account.ID)
+	if bonus != 0 || points != 0 {
+		t.Errorf("\ngot > bonus %v, points %v after rebuild \nwant > 0, 0", bonus, points)
+	}
+}
@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// ErrLimitExceeded is matched by every LimitError with errors.Is
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// LimitRule names the rule which was violated
+type LimitRule string
+
+// limit rules
+const (
+	LimitMaxPayment   LimitRule = "max_payment"
+	LimitDailyTotal   LimitRule = "daily_total"
+	LimitMonthlyTotal LimitRule = "monthly_total"
+	LimitHourlyCount  LimitRule = "hourly_count"
+)
+
+// Limits restricts payments, zero value of a field means no restriction.
+// Daily and monthly totals are counted from the start of the current day and month of the service clock,
+// number of payments per hour is counted over the last 60 minutes
+type Limits struct {
+	MaxPayment   types.Money
+	DailyTotal   types.Money
+	MonthlyTotal types.Money
+	MaxPerHour   int
+}
+
+// LimitError describes which limit was violated by payment
+type LimitError struct {
+	Rule      LimitRule
+	AccountID int64
+	// Category is empty when limit of the whole account was violated
+	Category types.PaymentCategory
+	// Limit and Attempted are amounts of money, or numbers of payments for LimitHourlyCount
+	Limit     int64
+	Attempted int64
+}
+
+func (e *LimitError) Error() string {
+	scope := fmt.Sprintf("account %d", e.AccountID)
+	if e.Category != "" {
+		scope += fmt.Sprintf(" category %s", e.Category)
+	}
+
+	return fmt.Sprintf("%s: %s limit %d, attempted %d", scope, e.Rule, e.Limit, e.Attempted)
+}
+
+// Is makes errors.Is(err, ErrLimitExceeded) true for every LimitError
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// SetAccountLimits restricts all payments of the account
+func (s *Service) SetAccountLimits(accountID int64, limits Limits) error {
+	_, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return ErrAccountNotFound
+	}
+
+	if s.accountLimits == nil {
+		s.accountLimits = make(map[int64]Limits)
+	}
+
+	s.accountLimits[accountID] = limits
+
+	return nil
+}
+
+// SetCategoryLimits restricts payments of the category, limits are applied to every account separately
+func (s *Service) SetCategoryLimits(category types.PaymentCategory, limits Limits) {
+	if s.categoryLimits == nil {
+		s.categoryLimits = make(map[types.PaymentCategory]Limits)
+	}
+
+	s.categoryLimits[category] = limits
+}
+
+// checkLimits returns LimitError if payment of amount violates limits of the account or of the category,
+// payments and active holds of the account are counted
+func (s *Service) checkLimits(accountID int64, amount types.Money, category types.PaymentCategory) error {
+	accountLimits, hasAccount := s.accountLimits[accountID]
+	categoryLimits, hasCategory := s.categoryLimits[category]
+	if !hasAccount && !hasCategory {
+		return nil
+	}
+
+	now := s.now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	hourAgo := now.Add(-time.Hour)
+
+	var account, inCategory limitUsage
+	for _, payment := range s.payments {
+		if payment.AccountID != accountID || payment.Status == types.PaymentStatusFail || payment.ParentID != "" {
+			continue
+		}
+
+		account.add(payment.Amount, payment.CreatedAt, dayStart, monthStart, hourAgo)
+		if payment.Category == category {
+			inCategory.add(payment.Amount, payment.CreatedAt, dayStart, monthStart, hourAgo)
+		}
+	}
+
+	// active holds are payments which are not captured yet, they use limits as well
+	for _, hold := range s.holds {
+		if hold.AccountID != accountID || !hold.reserves(now) {
+			continue
+		}
+
+		account.add(hold.Amount, hold.CreatedAt, dayStart, monthStart, hourAgo)
+		if hold.Category == category {
+			inCategory.add(hold.Amount, hold.CreatedAt, dayStart, monthStart, hourAgo)
+		}
+	}
+
+	if hasAccount {
+		if err := accountLimits.check(account, amount); err != nil {
+			err.AccountID = accountID
+			return err
+		}
+	}
+
+	if hasCategory {
+		if err := categoryLimits.check(inCategory, amount); err != nil {
+			err.AccountID = accountID
+			err.Category = category
+			return err
+		}
+	}
+
+	return nil
+}
+
+// limitUsage is how much of the limits is already used
+type limitUsage struct {
+	day     types.Money
+	month   types.Money
+	perHour int
+}
+
+func (u *limitUsage) add(amount types.Money, createdAt, dayStart, monthStart, hourAgo time.Time) {
+	if !createdAt.Before(dayStart) {
+		u.day += amount
+	}
+
+	if !createdAt.Before(monthStart) {
+		u.month += amount
+	}
+
+	if createdAt.After(hourAgo) {
+		u.perHour++
+	}
+}
+
+func (l Limits) check(usage limitUsage, amount types.Money) *LimitError {
+	if l.MaxPayment != 0 && amount > l.MaxPayment {
+		return &LimitError{Rule: LimitMaxPayment, Limit: int64(l.MaxPayment), Attempted: int64(amount)}
+	}
+
+	if l.DailyTotal != 0 && usage.day+amount > l.DailyTotal {
+		return &LimitError{Rule: LimitDailyTotal, Limit: int64(l.DailyTotal), Attempted: int64(usage.day + amount)}
+	}
+
+	if l.MonthlyTotal != 0 && usage.month+amount > l.MonthlyTotal {
+		return &LimitError{Rule: LimitMonthlyTotal, Limit: int64(l.MonthlyTotal), Attempted: int64(usage.month + amount)}
+	}
+
+	if l.MaxPerHour != 0 && usage.perHour+1 > l.MaxPerHour {
+		return &LimitError{Rule: LimitHourlyCount, Limit: int64(l.MaxPerHour), Attempted: int64(usage.perHour + 1)}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestService_Pay_accountLimits(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 31, 22, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 10_000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.SetAccountLimits(account.ID, Limits{MaxPayment: 500_00, DailyTotal: 800_00, MonthlyTotal: 1_500_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 600_00, "auto")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Rule != LimitMaxPayment || limitErr.Limit != 500_00 {
+		t.Errorf("\ngot > %v \nwant > %v", err, LimitMaxPayment)
+	}
+
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrLimitExceeded)
+	}
+
+	_, err = svc.Pay(account.ID, 500_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 400_00, "auto")
+	if !errors.As(err, &limitErr) || limitErr.Rule != LimitDailyTotal || limitErr.Attempted != 900_00 {
+		t.Errorf("\ngot > %v \nwant > %v", err, LimitDailyTotal)
+	}
+
+	// next day is the first day of the next month, both totals start over
+	clock.Advance(3 * time.Hour)
+
+	_, err = svc.Pay(account.ID, 500_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestService_Authorize_limits(t *testing.T) {
+	svc := &Service{}
+	svc.SetClock(NewManualClock(time.Date(2020, time.March, 31, 22, 0, 0, 0, time.UTC)))
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 10_000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.SetAccountLimits(account.ID, Limits{DailyTotal: 100_00, MaxPerHour: 2})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	hold, err := svc.Authorize(account.ID, 80_00, "hotel", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 30_00, "auto")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Rule != LimitDailyTotal || limitErr.Attempted != 110_00 {
+		t.Errorf("\ngot > %v \nwant > %v", err, LimitDailyTotal)
+	}
+
+	_, err = svc.Capture(hold.ID, 50_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Authorize(account.ID, 20_00, "hotel", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Authorize(account.ID, 10_00, "hotel", time.Hour)
+	if !errors.As(err, &limitErr) || limitErr.Rule != LimitHourlyCount {
+		t.Errorf("\ngot > %v \nwant > %v", err, LimitHourlyCount)
+	}
+
+	err = svc.SetAccountLimits(account.ID, Limits{DailyTotal: 100_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Authorize(account.ID, 30_00, "hotel", time.Hour)
+	if err != nil {
+		t.Errorf("\ngot > %v \nwant > captured hold is counted once", err)
+	}
+}
+
+func TestService_Pay_categoryLimits(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 31, 22, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 10_000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	svc.SetCategoryLimits("taxi", Limits{MaxPerHour: 2})
+
+	for i := 0; i < 2; i++ {
+		_, err := svc.Pay(account.ID, 10_00, "taxi")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		clock.Advance(10 * time.Minute)
+	}
+
+	_, err = svc.Pay(account.ID, 10_00, "food")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 10_00, "taxi")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Rule != LimitHourlyCount || limitErr.Category != "taxi" {
+		t.Errorf("\ngot > %v \nwant > %v", err, LimitHourlyCount)
+	}
+
+	clock.Advance(45 * time.Minute)
+
+	_, err = svc.Pay(account.ID, 10_00, "taxi")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestService_SetAccountLimits_notFound(t *testing.T) {
+	svc := &Service{}
+
+	err := svc.SetAccountLimits(1, Limits{MaxPayment: 1})
+	if err != ErrAccountNotFound {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountNotFound)
+	}
+}
@@ -0,0 +1,188 @@
+package wallet
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of merchants
+var (
+	ErrMerchantRegistered   = errors.New("merchant of category already registered")
+	ErrMerchantNotFound     = errors.New("merchant not found")
+	ErrUnknownCategory      = errors.New("unknown payment category")
+	ErrAmountBelowMinimum   = errors.New("amount is below minimum of merchant")
+	ErrAmountAboveMaximum   = errors.New("amount is above maximum of merchant")
+	ErrPaymentNotInProgress = errors.New("payment is not in progress")
+)
+
+// Merchant is a payee of payment category, completed payments are credited to its settlement account.
+// Zero MinAmount or MaxAmount means no restriction
+type Merchant struct {
+	Category            types.PaymentCategory
+	Name                string
+	SettlementAccountID int64
+	MinAmount           types.Money
+	MaxAmount           types.Money
+}
+
+// RegisterMerchant adds merchant of the category, settlement account must exist
+func (s *Service) RegisterMerchant(merchant Merchant) (*Merchant, error) {
+	if _, ok := s.merchants[merchant.Category]; ok {
+		return nil, ErrMerchantRegistered
+	}
+
+	_, err := s.FindAccountByID(merchant.SettlementAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.merchants == nil {
+		s.merchants = make(map[types.PaymentCategory]*Merchant)
+	}
+
+	s.merchants[merchant.Category] = &merchant
+
+	return &merchant, nil
+}
+
+// FindMerchant returns merchant of the category
+func (s *Service) FindMerchant(category types.PaymentCategory) (*Merchant, error) {
+	merchant, ok := s.merchants[category]
+	if !ok {
+		return nil, ErrMerchantNotFound
+	}
+
+	return merchant, nil
+}
+
+// Merchants returns all registered merchants sorted by category
+func (s *Service) Merchants() []Merchant {
+	merchants := make([]Merchant, 0, len(s.merchants))
+	for _, merchant := range s.merchants {
+		merchants = append(merchants, *merchant)
+	}
+
+	sort.Slice(merchants, func(i, j int) bool {
+		return merchants[i].Category < merchants[j].Category
+	})
+
+	return merchants
+}
+
+// SetStrictCategories makes Pay reject categories without registered merchant
+func (s *Service) SetStrictCategories(strict bool) {
+	s.strict = strict
+}
+
+// checkMerchant validates payment against rules of the merchant of the category
+func (s *Service) checkMerchant(amount types.Money, category types.PaymentCategory) error {
+	merchant, ok := s.merchants[category]
+	if !ok {
+		if s.strict {
+			return ErrUnknownCategory
+		}
+
+		return nil
+	}
+
+	if merchant.MinAmount != 0 && amount < merchant.MinAmount {
+		return ErrAmountBelowMinimum
+	}
+
+	if merchant.MaxAmount != 0 && amount > merchant.MaxAmount {
+		return ErrAmountAboveMaximum
+	}
+
+	return nil
+}
+
+// Settle completes payment which is in progress and credits its amount to settlement account of the merchant.
+// Payments held for review are completed by ApprovePayment, fees are completed together with their payments
+func (s *Service) Settle(paymentID string) error {
+	payment, err := s.FindPaymentByID(paymentID)
+	if err != nil {
+		return err
+	}
+
+	if payment.ParentID != "" {
+		return s.Settle(payment.ParentID)
+	}
+
+	if payment.Status != types.PaymentStatusInProgress {
+		return ErrPaymentNotInProgress
+	}
+
+	if _, err := s.findHeld(paymentID); err == nil {
+		return ErrPaymentHeld
+	}
+
+	return s.complete(payment)
+}
+
+// SettleAll completes all payments which are in progress and not held for review, returns number of settled payments.
+// Payments which can not be settled, e.g. because settlement account is frozen, stay in progress
+func (s *Service) SettleAll() int {
+	settled := 0
+	for _, payment := range s.payments {
+		if s.Settle(payment.ID) == nil {
+			settled++
+		}
+	}
+
+	return settled
+}
+
+// settlementAccount returns id of settlement account of the category, zero means there is no merchant
+func (s *Service) settlementAccount(category types.PaymentCategory) (int64, error) {
+	merchant, ok := s.merchants[category]
+	if !ok {
+		return 0, nil
+	}
+
+	account, err := s.FindAccountByID(merchant.SettlementAccountID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkAccountStatus(account); err != nil {
+		return 0, err
+	}
+
+	return account.ID, nil
+}
+
+// complete marks payment and its fees as completed and settles payment when merchant of its category is registered
+func (s *Service) complete(payment *types.Payment) error {
+	accountID, err := s.settlementAccount(payment.Category)
+	if err != nil {
+		return err
+	}
+
+	event := PaymentCompleted{PaymentID: payment.ID, AccountID: payment.AccountID}
+	if accountID != 0 {
+		event.SettlementAccountID = accountID
+		event.Amount = payment.Amount
+	}
+
+	err = s.emit(event)
+	if err != nil {
+		return err
+	}
+
+	err = s.accrueRewards(payment)
+	if err != nil {
+		return err
+	}
+
+	for _, fee := range s.fees(payment.ID) {
+		if fee.Status == types.PaymentStatusInProgress {
+			if err := s.emit(PaymentCompleted{PaymentID: fee.ID, AccountID: fee.AccountID}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,397 @@
+package wallet
+
+import (
+	"testing"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_Pay_strictCategories(t *testing.T) {
+	svc := &Service{}
+
+	customer, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(customer.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	merchant, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.RegisterMerchant(Merchant{
+		Category:            "megafon",
+		Name:                "Мегафон",
+		SettlementAccountID: merchant.ID,
+		MinAmount:           1_00,
+		MaxAmount:           500_00,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(customer.ID, 10_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	svc.SetStrictCategories(true)
+
+	if _, err := svc.Pay(customer.ID, 10_00, "auto"); err != ErrUnknownCategory {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrUnknownCategory)
+	}
+
+	if _, err := svc.Pay(customer.ID, 50, "megafon"); err != ErrAmountBelowMinimum {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAmountBelowMinimum)
+	}
+
+	if _, err := svc.Pay(customer.ID, 600_00, "megafon"); err != ErrAmountAboveMaximum {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAmountAboveMaximum)
+	}
+
+	_, err = svc.Pay(customer.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.RegisterMerchant(Merchant{Category: "megafon", SettlementAccountID: 1}); err != ErrMerchantRegistered {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrMerchantRegistered)
+	}
+}
+
+func TestService_Settle_success(t *testing.T) {
+	svc := &Service{}
+
+	customer, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(customer.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	merchant, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.RegisterMerchant(Merchant{
+		Category:            "megafon",
+		Name:                "Мегафон",
+		SettlementAccountID: merchant.ID,
+		MinAmount:           1_00,
+		MaxAmount:           500_00,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(customer.ID, 100_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	other, err := svc.Pay(customer.ID, 100_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if settled := svc.SettleAll(); settled != 2 {
+		t.Errorf("\ngot > %v \nwant > %v", settled, 2)
+	}
+
+	if payment.Status != types.PaymentStatusOk || other.Status != types.PaymentStatusOk || merchant.Balance != 100_00 {
+		t.Errorf("\ngot > %v, %v, merchant balance %v", payment.Status, other.Status, merchant.Balance)
+	}
+
+	if err := svc.Settle(payment.ID); err != ErrPaymentNotInProgress {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPaymentNotInProgress)
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if customer.Balance != 900_00 || merchant.Balance != 0 {
+		t.Errorf("\ngot > customer %v, merchant %v \nwant > customer 90000, merchant 0", customer.Balance, merchant.Balance)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if report := svc.Reconcile(); !report.OK() {
+		t.Errorf("\ngot > %+v \nwant > clean report", report.Issues)
+	}
+}
+
+func TestService_Settle_frozenMerchant(t *testing.T) {
+	svc := &Service{}
+
+	customer, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(customer.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	merchant, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.RegisterMerchant(Merchant{
+		Category:            "megafon",
+		Name:                "Мегафон",
+		SettlementAccountID: merchant.ID,
+		MinAmount:           1_00,
+		MaxAmount:           500_00,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(customer.ID, 100_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.FreezeAccount(merchant.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.Settle(payment.ID); err != ErrAccountFrozen {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountFrozen)
+	}
+
+	if payment.Status != types.PaymentStatusInProgress || merchant.Balance != 0 {
+		t.Errorf("\ngot > %v, merchant balance %v \nwant > payment stays in progress", payment.Status, merchant.Balance)
+	}
+}
+
+func TestService_Authorize_merchantAmounts(t *testing.T) {
+	svc := &Service{}
+
+	customer, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(customer.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	merchant, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.RegisterMerchant(Merchant{
+		Category:            "megafon",
+		Name:                "Мегафон",
+		SettlementAccountID: merchant.ID,
+		MinAmount:           1_00,
+		MaxAmount:           500_00,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.Authorize(customer.ID, 600_00, "megafon", 0); err != ErrAmountAboveMaximum {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAmountAboveMaximum)
+	}
+
+	if _, err := svc.Authorize(customer.ID, 50, "megafon", 0); err != ErrAmountBelowMinimum {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAmountBelowMinimum)
+	}
+
+	svc.SetStrictCategories(true)
+	if _, err := svc.Authorize(customer.ID, 10_00, "auto", 0); err != ErrUnknownCategory {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrUnknownCategory)
+	}
+}
+
+func TestService_Reject_settledAfterImport(t *testing.T) {
+	svc := &Service{}
+
+	customer, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(customer.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	merchant, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.RegisterMerchant(Merchant{
+		Category:            "megafon",
+		Name:                "Мегафон",
+		SettlementAccountID: merchant.ID,
+		MinAmount:           1_00,
+		MaxAmount:           500_00,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(customer.ID, 100_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Settle(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = imported.FreezeAccount(merchant.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := imported.Reject(payment.ID); err != ErrAccountFrozen {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountFrozen)
+	}
+
+	err = imported.UnfreezeAccount(merchant.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = imported.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	customer, _ = imported.FindAccountByID(customer.ID)
+	merchant, _ = imported.FindAccountByID(merchant.ID)
+	if customer.Balance != 1000_00 || merchant.Balance != 0 {
+		t.Errorf("\ngot > customer %v, merchant %v \nwant > customer 100000, merchant 0", customer.Balance, merchant.Balance)
+	}
+}
+
+func TestService_Reject_settlementSpent(t *testing.T) {
+	svc := &Service{}
+
+	customer, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(customer.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	merchant, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.RegisterMerchant(Merchant{
+		Category:            "megafon",
+		Name:                "Мегафон",
+		SettlementAccountID: merchant.ID,
+		MinAmount:           1_00,
+		MaxAmount:           500_00,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(customer.ID, 100_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Settle(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(merchant.ID, 50_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.Reject(payment.ID); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughBalance)
+	}
+
+	if customer.Balance != 900_00 || merchant.Balance != 50_00 || payment.Status != types.PaymentStatusOk {
+		t.Errorf("\ngot > customer %v, merchant %v, %v \nwant > nothing rejected", customer.Balance, merchant.Balance, payment.Status)
+	}
+}
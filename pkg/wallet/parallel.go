@@ -0,0 +1,210 @@
+package wallet
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Mapper processes items [from, to) of a collection and returns partial result
+type Mapper func(ctx context.Context, from, to int) (interface{}, error)
+
+// Reducer receives partial results one by one in order of parts
+type Reducer func(result interface{})
+
+// WorkerCount returns number of workers used to process length items,
+// non-positive requested count means one worker per CPU
+func WorkerCount(length, requested int) int {
+	workers := requested
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	if length > 0 && workers > length {
+		workers = length
+	}
+
+	return workers
+}
+
+// ChunkSize returns size of a part when length items are split between workers
+func ChunkSize(length, workers int) int {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	size := length / workers
+	if length%workers != 0 {
+		size++
+	}
+
+	return size
+}
+
+// MapReduce splits [0, length) into parts of ChunkSize, maps every part in its own goroutine
+// and reduces partial results in order of parts. First error cancels the remaining parts and is returned,
+// cancellation of ctx is reported as ctx.Err()
+func MapReduce(ctx context.Context, length, workers int, mapper Mapper, reducer Reducer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	size := ChunkSize(length, WorkerCount(length, workers))
+	if size == 0 {
+		return ctx.Err()
+	}
+
+	parts := (length + size - 1) / size
+	results := make([]interface{}, parts)
+
+	wg := sync.WaitGroup{}
+	wg.Add(parts)
+
+	once := sync.Once{}
+	var firstErr error
+
+	for part := 0; part < parts; part++ {
+		go func(part int) {
+			defer wg.Done()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			result, err := mapper(ctx, part*size, Min((part+1)*size, length))
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+
+			results[part] = result
+		}(part)
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if reducer != nil {
+		for _, result := range results {
+			reducer(result)
+		}
+	}
+
+	return nil
+}
+
+// ForEachPart splits [0, length) into parts of partSize and processes them by a pool of workers,
+// fn is called for every part as soon as a worker is free. First error stops the remaining parts and is returned,
+// cancellation of ctx is reported as ctx.Err()
+func ForEachPart(ctx context.Context, length, partSize, workers int, fn func(ctx context.Context, part, from, to int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if partSize <= 0 {
+		partSize = 1
+	}
+
+	parts := (length + partSize - 1) / partSize
+	workers = WorkerCount(parts, workers)
+
+	next := make(chan int)
+	go func() {
+		defer close(next)
+
+		for part := 0; part < parts; part++ {
+			select {
+			case next <- part:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+
+	once := sync.Once{}
+	var firstErr error
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for part := range next {
+				if ctx.Err() != nil {
+					return
+				}
+
+				err := fn(ctx, part, part*partSize, Min((part+1)*partSize, length))
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
+
+// MapReducePayments runs MapReduce over payments of the service
+func (s *Service) MapReducePayments(ctx context.Context, workers int,
+	mapper func(ctx context.Context, payments []*types.Payment) (interface{}, error), reducer Reducer) error {
+	payments := s.payments
+
+	return MapReduce(ctx, len(payments), workers, func(ctx context.Context, from, to int) (interface{}, error) {
+		return mapper(ctx, payments[from:to])
+	}, reducer)
+}
+
+// MapReduceAccounts runs MapReduce over accounts of the service
+func (s *Service) MapReduceAccounts(ctx context.Context, workers int,
+	mapper func(ctx context.Context, accounts []*types.Account) (interface{}, error), reducer Reducer) error {
+	accounts := s.accounts
+
+	return MapReduce(ctx, len(accounts), workers, func(ctx context.Context, from, to int) (interface{}, error) {
+		return mapper(ctx, accounts[from:to])
+	}, reducer)
+}
+
+// MapReduceFavorites runs MapReduce over favorites of the service
+func (s *Service) MapReduceFavorites(ctx context.Context, workers int,
+	mapper func(ctx context.Context, favorites []*types.Favorite) (interface{}, error), reducer Reducer) error {
+	favorites := s.favorites
+
+	return MapReduce(ctx, len(favorites), workers, func(ctx context.Context, from, to int) (interface{}, error) {
+		return mapper(ctx, favorites[from:to])
+	}, reducer)
+}
+
+// checkEvery is how many items are processed between checks of context cancellation
+const checkEvery = 1024
+
+// canceled reports context error every checkEvery items, so long loops stay cheap and cancellable
+func canceled(ctx context.Context, index int) error {
+	if index%checkEvery != 0 {
+		return nil
+	}
+
+	return ctx.Err()
+}
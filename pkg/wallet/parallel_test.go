@@ -0,0 +1,109 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestMapReduce_order(t *testing.T) {
+	var parts [][2]int
+
+	err := MapReduce(context.Background(), 10, 4, func(ctx context.Context, from, to int) (interface{}, error) {
+		return [2]int{from, to}, nil
+	}, func(result interface{}) {
+		parts = append(parts, result.([2]int))
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want := [][2]int{{0, 3}, {3, 6}, {6, 9}, {9, 10}}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("\ngot > %v \nwant > %v", parts, want)
+	}
+}
+
+func TestMapReduce_error(t *testing.T) {
+	errPart := errors.New("part failed")
+	reduced := false
+
+	err := MapReduce(context.Background(), 100, 10, func(ctx context.Context, from, to int) (interface{}, error) {
+		if from == 50 {
+			return nil, errPart
+		}
+
+		return nil, nil
+	}, func(result interface{}) {
+		reduced = true
+	})
+
+	if err != errPart || reduced {
+		t.Errorf("\ngot > %v %v \nwant > %v false", err, reduced, errPart)
+	}
+}
+
+func TestService_MapReducePayments_canceled(t *testing.T) {
+	svc := &Service{}
+	for i := 0; i < 10_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: 1})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := svc.MapReducePayments(ctx, 4, sumPayments, nil)
+	if err != context.Canceled {
+		t.Errorf("\ngot > %v \nwant > %v", err, context.Canceled)
+	}
+
+	if sum := svc.SumPayments(0); sum != 10_000 {
+		t.Errorf("\ngot > %v \nwant > 10000", sum)
+	}
+}
+
+func TestService_SumPaymentsWithProgressContext_success(t *testing.T) {
+	svc := &Service{}
+	for i := 0; i < 250_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: 2})
+	}
+
+	parts := make(map[int]types.Money)
+	var total types.Progress
+	for progress := range svc.SumPaymentsWithProgressContext(context.Background(), 50_000, 3) {
+		if progress.Done {
+			total = progress
+			continue
+		}
+
+		parts[progress.Part] = progress.Result
+	}
+
+	if len(parts) != 5 || parts[4] != 100_000 {
+		t.Errorf("\ngot > %v \nwant > 5 parts of 100000", parts)
+	}
+
+	if total.Result != 500_000 || total.Part != 5 {
+		t.Errorf("\ngot > %+v \nwant > total 500000", total)
+	}
+}
+
+func TestService_SumPaymentsWithProgressContext_canceled(t *testing.T) {
+	svc := &Service{}
+	for i := 0; i < 100_000; i++ {
+		svc.payments = append(svc.payments, &types.Payment{Amount: 1})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for progress := range svc.SumPaymentsWithProgressContext(ctx, 1_000, 2) {
+		if progress.Done {
+			t.Errorf("\ngot > %+v \nwant > no total after cancellation", progress)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of pockets
+var (
+	ErrPocketNotFound    = errors.New("pocket not found")
+	ErrPocketExists      = errors.New("pocket already exists")
+	ErrInvalidPocketName = errors.New("invalid pocket name")
+	ErrSamePocket        = errors.New("can not move money to the same pocket")
+)
+
+// MainPocket is the name of main part of account balance which does not belong to any pocket
+const MainPocket = ""
+
+// Pocket earmarks part of account balance under a name. Money of pockets stays in account balance,
+// but it is spent only by PayFromPocket and can not be withdrawn or held until it is moved to the main pocket
+type Pocket struct {
+	AccountID int64
+	Name      string
+	Balance   types.Money
+	// Goal is optional savings goal, zero means no goal
+	Goal      types.Money
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// GoalReached reports whether pocket has savings goal and its balance reached the goal
+func (p *Pocket) GoalReached() bool {
+	return p.Goal > 0 && p.Balance >= p.Goal
+}
+
+// Progress returns percent of savings goal which is reached, it is zero when pocket has no goal
+func (p *Pocket) Progress() int {
+	if p.Goal <= 0 || p.Balance <= 0 {
+		return 0
+	}
+
+	if p.Balance >= p.Goal {
+		return 100
+	}
+
+	return int(p.Balance * 100 / p.Goal)
+}
+
+// CreatePocket creates empty pocket of account, goal is optional
+func (s *Service) CreatePocket(accountID int64, name string, goal types.Money) (*Pocket, error) {
+	if name == MainPocket || strings.ContainsAny(name, ";\n") {
+		return nil, ErrInvalidPocketName
+	}
+
+	if goal < 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAccountStatus(account); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.FindPocket(account.ID, name); err == nil {
+		return nil, ErrPocketExists
+	}
+
+	now := s.now()
+	err = s.emitAt(now, PocketCreated{Pocket: Pocket{
+		AccountID: account.ID,
+		Name:      name,
+		Goal:      goal,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.pockets[len(s.pockets)-1], nil
+}
+
+// SetPocketGoal changes savings goal of the pocket, zero goal removes it
+func (s *Service) SetPocketGoal(accountID int64, name string, goal types.Money) error {
+	if goal < 0 {
+		return ErrAmountMustBePositive
+	}
+
+	pocket, err := s.FindPocket(accountID, name)
+	if err != nil {
+		return err
+	}
+
+	return s.emit(PocketGoalSet{AccountID: pocket.AccountID, Name: pocket.Name, Goal: goal})
+}
+
+// MovePocketFunds moves amount between pockets of account, MainPocket is the main balance
+func (s *Service) MovePocketFunds(accountID int64, from, to string, amount types.Money) error {
+	if amount <= 0 {
+		return ErrAmountMustBePositive
+	}
+
+	if from == to {
+		return ErrSamePocket
+	}
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkAccountStatus(account); err != nil {
+		return err
+	}
+
+	available, err := s.pocketAvailable(account, from)
+	if err != nil {
+		return err
+	}
+
+	if to != MainPocket {
+		if _, err := s.FindPocket(account.ID, to); err != nil {
+			return err
+		}
+	}
+
+	if available < amount {
+		return ErrNotEnoughBalance
+	}
+
+	return s.emit(PocketMoved{AccountID: account.ID, From: from, To: to, Amount: amount})
+}
+
+// DeletePocket removes pocket of account, its money returns to the main pocket
+func (s *Service) DeletePocket(accountID int64, name string) error {
+	pocket, err := s.FindPocket(accountID, name)
+	if err != nil {
+		return err
+	}
+
+	return s.emit(PocketDeleted{AccountID: pocket.AccountID, Name: pocket.Name})
+}
+
+// PayFromPocket is the same as Pay, but amount and fee are paid from the pocket.
+// Rejected payment returns to the pocket if it still exists
+func (s *Service) PayFromPocket(accountID int64, name string, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	if name == MainPocket {
+		return s.Pay(accountID, amount, category)
+	}
+
+	return s.pay(accountID, amount, category, name, nil)
+}
+
+// FindPocket returns pocket of account by name
+func (s *Service) FindPocket(accountID int64, name string) (*Pocket, error) {
+	for _, pocket := range s.pockets {
+		if pocket.AccountID == accountID && pocket.Name == name {
+			return pocket, nil
+		}
+	}
+
+	return nil, ErrPocketNotFound
+}
+
+// Pockets returns pockets of account sorted by name
+func (s *Service) Pockets(accountID int64) ([]Pocket, error) {
+	_, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pockets []Pocket
+	for _, pocket := range s.pockets {
+		if pocket.AccountID == accountID {
+			pockets = append(pockets, *pocket)
+		}
+	}
+
+	sort.Slice(pockets, func(i, j int) bool {
+		return pockets[i].Name < pockets[j].Name
+	})
+
+	return pockets, nil
+}
+
+// pocketAvailable returns money of account which can be spent from the pocket
+func (s *Service) pocketAvailable(account *types.Account, name string) (types.Money, error) {
+	if name == MainPocket {
+		return s.availableBalance(account), nil
+	}
+
+	pocket, err := s.FindPocket(account.ID, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return pocket.Balance, nil
+}
+
+// pocketsBalance returns money of account which belongs to pockets
+func (s *Service) pocketsBalance(accountID int64) types.Money {
+	var balance types.Money
+	for _, pocket := range s.pockets {
+		if pocket.AccountID == accountID {
+			balance += pocket.Balance
+		}
+	}
+
+	return balance
+}
+
+// deletePockets publishes deletion of all pockets of account, e.g. before it is closed
+func (s *Service) deletePockets(accountID int64) error {
+	var names []string
+	for _, pocket := range s.pockets {
+		if pocket.AccountID == accountID {
+			names = append(names, pocket.Name)
+		}
+	}
+
+	for _, name := range names {
+		if err := s.emit(PocketDeleted{AccountID: accountID, Name: name}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyPocket changes balance of pocket, it is called by apply
+func (s *Service) applyPocket(accountID int64, name string, amount types.Money, now time.Time) {
+	if name == MainPocket {
+		return
+	}
+
+	if pocket, err := s.FindPocket(accountID, name); err == nil {
+		pocket.Balance += amount
+		pocket.UpdatedAt = now
+	}
+}
+
+// removePocket removes pocket, it is called by apply
+func (s *Service) removePocket(accountID int64, name string) {
+	for index, pocket := range s.pockets {
+		if pocket.AccountID == accountID && pocket.Name == name {
+			s.pockets = append(s.pockets[:index], s.pockets[index+1:]...)
+			return
+		}
+	}
+}
+
+// WritePocketsToFile is a helper function to write pockets to respective file
+func WritePocketsToFile(filePath string, pockets []*Pocket) error {
+	return writePocketsToFile(context.Background(), filePath, pockets)
+}
+
+func writePocketsToFile(ctx context.Context, filePath string, pockets []*Pocket) error {
+	if len(pockets) == 0 {
+		return nil
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	defer func() {
+		err = file.Close()
+		if err != nil {
+			log.Print(err)
+		}
+	}()
+
+	for index, pocket := range pockets {
+		if err := canceled(ctx, index); err != nil {
+			return err
+		}
+
+		nl := ""
+		if index != 0 {
+			nl = "\n"
+		}
+
+		_, err := file.Write([]byte(nl + strconv.FormatInt(pocket.AccountID, 10) + ";" + pocket.Name + ";" +
+			strconv.FormatInt(int64(pocket.Balance), 10) + ";" + strconv.FormatInt(int64(pocket.Goal), 10) + ";" +
+			formatTime(pocket.CreatedAt) + ";" + formatTime(pocket.UpdatedAt)))
+		if err != nil {
+			log.Print(err)
+			return err
+		}
+	}
+
+	return err
+}
+
+// parsePocketLine parses line of pockets.dump, missing fields are left zero
+func parsePocketLine(line string) Pocket {
+	pocket := Pocket{}
+	words := strings.Split(line, ";")
+
+	for index, word := range words {
+		switch index {
+		case 0:
+			pocket.AccountID, _ = strconv.ParseInt(word, 10, 64)
+		case 1:
+			pocket.Name = word
+		case 2:
+			balance, _ := strconv.ParseInt(word, 10, 64)
+			pocket.Balance = types.Money(balance)
+		case 3:
+			goal, _ := strconv.ParseInt(word, 10, 64)
+			pocket.Goal = types.Money(goal)
+		case 4:
+			pocket.CreatedAt = parseTime(word)
+		case 5:
+			pocket.UpdatedAt = parseTime(word)
+		}
+	}
+
+	return pocket
+}
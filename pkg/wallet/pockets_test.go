@@ -0,0 +1,259 @@
+package wallet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestService_PayFromPocket_success(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	pocket, err := svc.CreatePocket(account.ID, "отпуск", 500_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.CreatePocket(account.ID, "отпуск", 0); err != ErrPocketExists {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPocketExists)
+	}
+
+	err = svc.MovePocketFunds(account.ID, MainPocket, "отпуск", 300_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.Pay(account.ID, 800_00, "auto"); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > pocket money is not spent by Pay", err)
+	}
+
+	if _, err := svc.PayFromPocket(account.ID, "отпуск", 400_00, "travel"); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughBalance)
+	}
+
+	payment, err := svc.PayFromPocket(account.ID, "отпуск", 100_00, "travel")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if account.Balance != 900_00 || pocket.Balance != 200_00 || pocket.Progress() != 40 {
+		t.Errorf("\ngot > balance %v, pocket %v \nwant > 90000, 20000", account.Balance, pocket.Balance)
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if pocket.Balance != 300_00 {
+		t.Errorf("\ngot > %v \nwant > payment returned to pocket", pocket.Balance)
+	}
+
+	err = svc.SetPocketGoal(account.ID, "отпуск", 300_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !pocket.GoalReached() {
+		t.Errorf("\ngot > %+v \nwant > goal reached", pocket)
+	}
+
+	err = svc.DeletePocket(account.ID, "отпуск")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if available, _ := svc.AvailableBalance(account.ID); available != 1000_00 {
+		t.Errorf("\ngot > %v \nwant > pocket money returned to main balance", available)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_Import_pockets(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, name := range []string{"car", "rent"} {
+		_, err = svc.CreatePocket(account.ID, name, 1000_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = svc.MovePocketFunds(account.ID, MainPocket, name, 30_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	payment, err := svc.PayFromPocket(account.ID, "rent", 10_00, "rent")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	pockets, err := imported.Pockets(account.ID)
+	if err != nil || len(pockets) != 2 || pockets[1].Name != "rent" || pockets[1].Balance != 20_00 || pockets[1].Goal != 1000_00 {
+		t.Errorf("\ngot > %+v, %v \nwant > imported pockets", pockets, err)
+	}
+
+	if available, _ := imported.AvailableBalance(account.ID); available != 40_00 {
+		t.Errorf("\ngot > %v \nwant > %v", available, 40_00)
+	}
+
+	err = imported.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rent, _ := imported.FindPocket(account.ID, "rent")
+	if available, _ := imported.AvailableBalance(account.ID); available != 40_00 || rent.Balance != 30_00 {
+		t.Errorf("\ngot > available %v, rent %v \nwant > refund returned to the pocket", available, rent.Balance)
+	}
+}
+
+func TestService_Statement_pockets(t *testing.T) {
+	clock := NewManualClock(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC))
+	svc := &Service{}
+	svc.SetClock(clock)
+	svc.SetEventStore(&MemoryEventStore{})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.CreatePocket(account.ID, "savings", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.MovePocketFunds(account.ID, MainPocket, "savings", 20_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(24 * time.Hour)
+	from := clock.Now()
+
+	err = svc.MovePocketFunds(account.ID, MainPocket, "savings", 30_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	statement, err := svc.Statement(account.ID, from, time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(statement.Lines) != 0 || len(statement.Pockets) != 1 {
+		t.Errorf("\ngot > %+v \nwant > no lines and one pocket", statement)
+		return
+	}
+
+	pocket := statement.Pockets[0]
+	if pocket.Name != "savings" || pocket.ClosingBalance != 50_00 {
+		t.Errorf("\ngot > %+v \nwant > savings 5000", pocket)
+	}
+}
+
+func TestService_Statement_pocketsWithoutStore(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.CreatePocket(account.ID, "savings", 80_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.MovePocketFunds(account.ID, MainPocket, "savings", 30_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	statement, err := svc.Statement(account.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want := []PocketTotal{{Name: "savings", Goal: 80_00, ClosingBalance: 30_00}}
+	if !reflect.DeepEqual(statement.Pockets, want) {
+		t.Errorf("\ngot > %+v \nwant > %+v", statement.Pockets, want)
+	}
+}
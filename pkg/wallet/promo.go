@@ -0,0 +1,234 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of promo campaigns
+var (
+	ErrPromoExists          = errors.New("promo code already exists")
+	ErrPromoNotFound        = errors.New("promo code not found")
+	ErrPromoNotActive       = errors.New("promo code is not active")
+	ErrPromoAlreadyRedeemed = errors.New("promo code already redeemed by account")
+	ErrPromoBudgetExhausted = errors.New("promo budget is exhausted")
+	ErrDepositBelowMinimum  = errors.New("deposit is below minimum of promo")
+)
+
+// PromoCampaign credits Bonus to account which deposits at least MinDeposit with the code
+// within [From, To). Zero From or To means unbounded window, zero Budget means unlimited budget
+type PromoCampaign struct {
+	Code       string
+	Bonus      types.Money
+	From       time.Time
+	To         time.Time
+	Budget     types.Money
+	MinDeposit types.Money
+}
+
+type promoKey struct {
+	Code      string
+	AccountID int64
+}
+
+// CreatePromo adds promo campaign, codes are case insensitive
+func (s *Service) CreatePromo(campaign PromoCampaign) (*PromoCampaign, error) {
+	if campaign.Bonus <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	campaign.Code = strings.ToUpper(campaign.Code)
+	if _, ok := s.promos[campaign.Code]; ok {
+		return nil, ErrPromoExists
+	}
+
+	if s.promos == nil {
+		s.promos = make(map[string]*PromoCampaign)
+	}
+
+	s.promos[campaign.Code] = &campaign
+
+	return &campaign, nil
+}
+
+// PromoSpent returns bonus money already credited by the campaign
+func (s *Service) PromoSpent(code string) types.Money {
+	return s.promoSpent[strings.ToUpper(code)]
+}
+
+// BonusBalance returns bonus money of account, it can be spent by Pay but is not withdrawn or transferred
+func (s *Service) BonusBalance(accountID int64) (types.Money, error) {
+	_, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.bonus[accountID], nil
+}
+
+// DepositWithPromo deposits amount and credits bonus of the promo code, it returns credited bonus.
+// Nothing is deposited when promo code can not be redeemed
+func (s *Service) DepositWithPromo(accountID int64, amount types.Money, code string) (types.Money, error) {
+	campaign, ok := s.promos[strings.ToUpper(code)]
+	if !ok {
+		return 0, ErrPromoNotFound
+	}
+
+	now := s.now()
+	if !campaign.From.IsZero() && now.Before(campaign.From) || !campaign.To.IsZero() && !now.Before(campaign.To) {
+		return 0, ErrPromoNotActive
+	}
+
+	if _, ok := s.promoRedeemed[promoKey{Code: campaign.Code, AccountID: accountID}]; ok {
+		return 0, ErrPromoAlreadyRedeemed
+	}
+
+	if campaign.Budget != 0 && s.promoSpent[campaign.Code]+campaign.Bonus > campaign.Budget {
+		return 0, ErrPromoBudgetExhausted
+	}
+
+	if amount < campaign.MinDeposit {
+		return 0, ErrDepositBelowMinimum
+	}
+
+	err := s.Deposit(accountID, amount)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.emitAt(now, PromoRedeemed{AccountID: accountID, Code: campaign.Code, Bonus: campaign.Bonus})
+	if err != nil {
+		return 0, err
+	}
+
+	return campaign.Bonus, nil
+}
+
+// bonusFor returns part of amount which is paid from bonus balance
+func (s *Service) bonusFor(accountID int64, amount types.Money) types.Money {
+	bonus := s.bonus[accountID]
+	if bonus > amount {
+		return amount
+	}
+
+	if bonus < 0 {
+		return 0
+	}
+
+	return bonus
+}
+
+// applyBonus changes bonus balance, it is called by apply
+func (s *Service) applyBonus(accountID int64, amount types.Money) {
+	if amount == 0 {
+		return
+	}
+
+	if s.bonus == nil {
+		s.bonus = make(map[int64]types.Money)
+	}
+
+	s.bonus[accountID] += amount
+}
+
+// applyPromo records redeemed promo code, it is called by apply
+func (s *Service) applyPromo(event PromoRedeemed) {
+	if s.promoSpent == nil {
+		s.promoSpent = make(map[string]types.Money)
+		s.promoRedeemed = make(map[promoKey]types.Money)
+	}
+
+	s.promoSpent[event.Code] += event.Bonus
+	s.promoRedeemed[promoKey{Code: event.Code, AccountID: event.AccountID}] = event.Bonus
+	s.applyBonus(event.AccountID, event.Bonus)
+}
+
+// applyPromoImport records imported promo code without crediting its bonus, it is called by apply
+func (s *Service) applyPromoImport(event PromoImported) {
+	if s.promoSpent == nil {
+		s.promoSpent = make(map[string]types.Money)
+		s.promoRedeemed = make(map[promoKey]types.Money)
+	}
+
+	key := promoKey{Code: event.Code, AccountID: event.AccountID}
+	s.promoSpent[event.Code] += event.Bonus - s.promoRedeemed[key]
+	s.promoRedeemed[key] = event.Bonus
+}
+
+// writePromosToFile writes promo codes redeemed by accounts to file, the file is written even when it is empty,
+// so promo codes of previous export are not imported again
+func (s *Service) writePromosToFile(ctx context.Context, filePath string) error {
+	keys := make([]promoKey, 0, len(s.promoRedeemed))
+	for key := range s.promoRedeemed {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Code != keys[j].Code {
+			return keys[i].Code < keys[j].Code
+		}
+
+		return keys[i].AccountID < keys[j].AccountID
+	})
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	defer func() {
+		err = file.Close()
+		if err != nil {
+			log.Print(err)
+		}
+	}()
+
+	for index, key := range keys {
+		if err := canceled(ctx, index); err != nil {
+			return err
+		}
+
+		nl := ""
+		if index != 0 {
+			nl = "\n"
+		}
+
+		_, err := file.Write([]byte(nl + key.Code + ";" + strconv.FormatInt(key.AccountID, 10) + ";" +
+			strconv.FormatInt(int64(s.promoRedeemed[key]), 10)))
+		if err != nil {
+			log.Print(err)
+			return err
+		}
+	}
+
+	return err
+}
+
+// parsePromoLine parses line of promos.dump
+func parsePromoLine(line string) PromoImported {
+	event := PromoImported{}
+	words := strings.Split(line, ";")
+
+	for index, word := range words {
+		switch index {
+		case 0:
+			event.Code = word
+		case 1:
+			event.AccountID, _ = strconv.ParseInt(word, 10, 64)
+		case 2:
+			bonus, _ := strconv.ParseInt(word, 10, 64)
+			event.Bonus = types.Money(bonus)
+		}
+	}
+
+	return event
+}
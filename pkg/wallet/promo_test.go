@@ -0,0 +1,273 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_DepositWithPromo_rules(t *testing.T) {
+	clock := NewManualClock(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC))
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "spring", Bonus: 50_00, Budget: 100_00, MinDeposit: 200_00,
+		From: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.CreatePromo(PromoCampaign{Code: "SPRING", Bonus: 1_00}); err != ErrPromoExists {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPromoExists)
+	}
+
+	var accounts []int64
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002", "+992000000003"} {
+		account, err := svc.RegisterAccount(phone)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accounts = append(accounts, account.ID)
+	}
+
+	if _, err := svc.DepositWithPromo(accounts[0], 100_00, "SPRING"); err != ErrDepositBelowMinimum {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrDepositBelowMinimum)
+	}
+
+	if _, err := svc.DepositWithPromo(accounts[0], 200_00, "summer"); err != ErrPromoNotFound {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPromoNotFound)
+	}
+
+	for _, id := range accounts[:2] {
+		bonus, err := svc.DepositWithPromo(id, 200_00, "Spring")
+		if err != nil || bonus != 50_00 {
+			t.Errorf("\ngot > %v, %v \nwant > %v", bonus, err, 50_00)
+			return
+		}
+	}
+
+	if _, err := svc.DepositWithPromo(accounts[0], 200_00, "spring"); err != ErrPromoAlreadyRedeemed {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPromoAlreadyRedeemed)
+	}
+
+	if _, err := svc.DepositWithPromo(accounts[2], 200_00, "spring"); err != ErrPromoBudgetExhausted {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPromoBudgetExhausted)
+	}
+
+	_, err = svc.CreatePromo(PromoCampaign{Code: "winter", Bonus: 10_00, To: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.DepositWithPromo(accounts[2], 200_00, "winter"); err != ErrPromoNotActive {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPromoNotActive)
+	}
+
+	account, _ := svc.FindAccountByID(accounts[2])
+	if account.Balance != 0 || svc.PromoSpent("spring") != 100_00 {
+		t.Errorf("\ngot > balance %v, spent %v \nwant > nothing deposited without promo", account.Balance, svc.PromoSpent("spring"))
+	}
+
+	if bonus, _ := svc.BonusBalance(accounts[0]); bonus != 50_00 {
+		t.Errorf("\ngot > %v \nwant > %v", bonus, 50_00)
+	}
+}
+
+func TestService_Pay_bonusFirst(t *testing.T) {
+	svc := &Service{}
+	svc.SetEventStore(&MemoryEventStore{})
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 30_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.DepositWithPromo(account.ID, 100_00, "welcome")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if _, err := svc.Pay(account.ID, 131_00, "auto"); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughBalance)
+	}
+
+	payment, err := svc.Pay(account.ID, 50_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bonus, _ := svc.BonusBalance(account.ID)
+	if account.Balance != 80_00 || bonus != 0 {
+		t.Errorf("\ngot > balance %v, bonus %v \nwant > 8000, 0", account.Balance, bonus)
+	}
+
+	report := svc.Reconcile()
+	if !report.OK() {
+		t.Errorf("\ngot > %+v \nwant > no issues", report.Issues)
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bonus, _ = svc.BonusBalance(account.ID)
+	if account.Balance != 100_00 || bonus != 30_00 {
+		t.Errorf("\ngot > balance %v, bonus %v \nwant > 10000, 3000", account.Balance, bonus)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+
+	rebuilt, err := Rebuild(svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if bonus, _ := rebuilt.BonusBalance(account.ID); bonus != 30_00 || rebuilt.PromoSpent("welcome") != 30_00 {
+		t.Errorf("\ngot > %v \nwant > %v after rebuild", bonus, 30_00)
+	}
+}
+
+func TestService_Reject_bonusAfterImport(t *testing.T) {
+	svc := &Service{}
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 30_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.DepositWithPromo(account.ID, 100_00, "welcome")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 50_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = imported.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, _ = imported.FindAccountByID(account.ID)
+	bonus, _ := imported.BonusBalance(account.ID)
+	if account.Balance != 100_00 || bonus != 30_00 {
+		t.Errorf("\ngot > balance %v, bonus %v \nwant > 10000, 3000", account.Balance, bonus)
+	}
+
+	err = imported.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_Import_promo(t *testing.T) {
+	svc := &Service{}
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 30_00, Budget: 90_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.DepositWithPromo(account.ID, 100_00, "welcome")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+	_, err = imported.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 30_00, Budget: 90_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bonus, _ := imported.BonusBalance(account.ID)
+	if bonus != 30_00 || imported.PromoSpent("welcome") != 30_00 {
+		t.Errorf("\ngot > bonus %v, spent %v \nwant > 3000, 3000", bonus, imported.PromoSpent("welcome"))
+	}
+
+	if _, err := imported.DepositWithPromo(account.ID, 100_00, "welcome"); err != ErrPromoAlreadyRedeemed {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPromoAlreadyRedeemed)
+	}
+
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bonus, _ = imported.BonusBalance(account.ID)
+	if bonus != 30_00 || imported.PromoSpent("welcome") != 30_00 {
+		t.Errorf("\ngot > bonus %v, spent %v after second import \nwant > 3000, 3000", bonus, imported.PromoSpent("welcome"))
+	}
+
+	err = imported.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,234 @@
+package wallet
+
+import (
+	"encoding/base64"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// ErrInvalidCursor is returned when cursor was not produced by query with the same filters and order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PaymentSortField is used to choose order of query results
+type PaymentSortField int
+
+// sort fields
+const (
+	SortByCreatedAt PaymentSortField = iota
+	SortByAmount
+	SortByID
+)
+
+// PaymentQuery describes which payments should be found, empty fields match every payment
+type PaymentQuery struct {
+	AccountIDs []int64
+	Categories []types.PaymentCategory
+	Statuses   []types.PaymentStatus
+	MinAmount  types.Money
+	MaxAmount  types.Money
+	// From is inclusive and To is exclusive bound of payment creation time
+	From       time.Time
+	To         time.Time
+	SortBy     PaymentSortField
+	Descending bool
+	// Limit is maximal size of the page, zero means all payments
+	Limit int
+	// Cursor is NextCursor of previous page, it is valid only for query with the same filters and order
+	Cursor string
+}
+
+// PaymentPage is a single page of query results
+type PaymentPage struct {
+	Payments []types.Payment
+	// NextCursor is empty when there are no more payments
+	NextCursor string
+}
+
+// QueryPayments finds payments matching the query, ordered and paginated
+func (s *Service) QueryPayments(query PaymentQuery) (*PaymentPage, error) {
+	var after *paymentKey
+	if query.Cursor != "" {
+		key, err := decodeCursor(query.Cursor, query.fingerprint())
+		if err != nil {
+			return nil, err
+		}
+
+		after = &key
+	}
+
+	var matched []types.Payment
+	for _, payment := range s.payments {
+		if !query.matches(*payment) {
+			continue
+		}
+
+		if after != nil && !query.less(*after, keyOf(*payment, query.SortBy)) {
+			continue
+		}
+
+		matched = append(matched, *payment)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return query.less(keyOf(matched[i], query.SortBy), keyOf(matched[j], query.SortBy))
+	})
+
+	page := &PaymentPage{Payments: matched}
+	if query.Limit > 0 && len(matched) > query.Limit {
+		page.Payments = matched[:query.Limit]
+		page.NextCursor = encodeCursor(keyOf(page.Payments[query.Limit-1], query.SortBy), query.fingerprint())
+	}
+
+	return page, nil
+}
+
+func (q PaymentQuery) matches(payment types.Payment) bool {
+	if len(q.AccountIDs) != 0 {
+		found := false
+		for _, accountID := range q.AccountIDs {
+			if payment.AccountID == accountID {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(q.Categories) != 0 {
+		found := false
+		for _, category := range q.Categories {
+			if payment.Category == category {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(q.Statuses) != 0 {
+		found := false
+		for _, status := range q.Statuses {
+			if payment.Status == status {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if q.MinAmount != 0 && payment.Amount < q.MinAmount {
+		return false
+	}
+
+	if q.MaxAmount != 0 && payment.Amount > q.MaxAmount {
+		return false
+	}
+
+	if !q.From.IsZero() && payment.CreatedAt.Before(q.From) {
+		return false
+	}
+
+	if !q.To.IsZero() && !payment.CreatedAt.Before(q.To) {
+		return false
+	}
+
+	return true
+}
+
+// paymentKey is a position of payment in sorted results, id breaks ties
+type paymentKey struct {
+	value int64
+	id    string
+}
+
+func keyOf(payment types.Payment, field PaymentSortField) paymentKey {
+	switch field {
+	case SortByAmount:
+		return paymentKey{value: int64(payment.Amount), id: payment.ID}
+	case SortByID:
+		return paymentKey{id: payment.ID}
+	}
+
+	return paymentKey{value: payment.CreatedAt.UnixNano(), id: payment.ID}
+}
+
+func (q PaymentQuery) less(a, b paymentKey) bool {
+	if q.Descending {
+		a, b = b, a
+	}
+
+	if a.value != b.value {
+		return a.value < b.value
+	}
+
+	return a.id < b.id
+}
+
+// fingerprint identifies filters and order of the query, so cursor of one query is not used by another
+func (q PaymentQuery) fingerprint() string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(int(q.SortBy)) + ";" + strconv.FormatBool(q.Descending))
+
+	b.WriteString(";")
+	for _, accountID := range q.AccountIDs {
+		b.WriteString(strconv.FormatInt(accountID, 10) + ",")
+	}
+
+	b.WriteString(";")
+	for _, category := range q.Categories {
+		b.WriteString(string(category) + ",")
+	}
+
+	b.WriteString(";")
+	for _, status := range q.Statuses {
+		b.WriteString(string(status) + ",")
+	}
+
+	b.WriteString(";" + strconv.FormatInt(int64(q.MinAmount), 10) + ";" + strconv.FormatInt(int64(q.MaxAmount), 10))
+	b.WriteString(";" + formatTime(q.From) + ";" + formatTime(q.To))
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(b.String()))
+
+	return strconv.FormatUint(hash.Sum64(), 36)
+}
+
+func encodeCursor(key paymentKey, fingerprint string) string {
+	data := fingerprint + ";" + strconv.FormatInt(key.value, 10) + ";" + key.id
+
+	return base64.RawURLEncoding.EncodeToString([]byte(data))
+}
+
+func decodeCursor(cursor string, fingerprint string) (paymentKey, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return paymentKey{}, ErrInvalidCursor
+	}
+
+	words := strings.SplitN(string(data), ";", 3)
+	if len(words) != 3 || words[0] != fingerprint {
+		return paymentKey{}, ErrInvalidCursor
+	}
+
+	value, err := strconv.ParseInt(words[1], 10, 64)
+	if err != nil {
+		return paymentKey{}, ErrInvalidCursor
+	}
+
+	return paymentKey{value: value, id: words[2]}, nil
+}
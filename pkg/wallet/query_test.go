@@ -0,0 +1,137 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_QueryPayments_filter(t *testing.T) {
+	start := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002"} {
+		account, err := svc.RegisterAccount(phone)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = svc.Deposit(account.ID, 1000_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	categories := []types.PaymentCategory{"auto", "megafon", "food"}
+	for i := 0; i < 6; i++ {
+		clock.Advance(time.Hour)
+
+		_, err := svc.Pay(int64(i%2+1), types.Money((i+1)*10_00), categories[i%3])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	page, err := svc.QueryPayments(PaymentQuery{
+		AccountIDs: []int64{1},
+		MinAmount:  20_00,
+		From:       start.Add(2 * time.Hour),
+		To:         start.Add(6 * time.Hour),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(page.Payments) != 2 || page.Payments[0].Amount != 30_00 || page.Payments[1].Amount != 50_00 {
+		t.Errorf("\ngot > %v \nwant > payments of 3000 and 5000", page.Payments)
+	}
+
+	if page.NextCursor != "" {
+		t.Errorf("\ngot > %v \nwant > empty cursor", page.NextCursor)
+	}
+}
+
+func TestService_QueryPayments_pagination(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002"} {
+		account, err := svc.RegisterAccount(phone)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = svc.Deposit(account.ID, 1000_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	categories := []types.PaymentCategory{"auto", "megafon", "food"}
+	for i := 0; i < 6; i++ {
+		clock.Advance(time.Hour)
+
+		_, err := svc.Pay(int64(i%2+1), types.Money((i+1)*10_00), categories[i%3])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	query := PaymentQuery{SortBy: SortByAmount, Descending: true, Limit: 4}
+
+	var amounts []types.Money
+	for {
+		page, err := svc.QueryPayments(query)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		for _, payment := range page.Payments {
+			amounts = append(amounts, payment.Amount)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		query.Cursor = page.NextCursor
+	}
+
+	if len(amounts) != 6 || amounts[0] != 60_00 || amounts[5] != 10_00 {
+		t.Errorf("\ngot > %v \nwant > 6 payments from 6000 down to 1000", amounts)
+	}
+
+	query.SortBy = SortByCreatedAt
+	_, err := svc.QueryPayments(query)
+	if err != ErrInvalidCursor {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrInvalidCursor)
+	}
+
+	query.SortBy = SortByAmount
+	query.Descending = false
+	_, err = svc.QueryPayments(query)
+	if err != ErrInvalidCursor {
+		t.Errorf("\ngot > %v \nwant > %v for other order", err, ErrInvalidCursor)
+	}
+
+	query.Descending = true
+	query.Categories = []types.PaymentCategory{"auto"}
+	_, err = svc.QueryPayments(query)
+	if err != ErrInvalidCursor {
+		t.Errorf("\ngot > %v \nwant > %v for other filters", err, ErrInvalidCursor)
+	}
+}
@@ -0,0 +1,429 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// kinds of balance records
+const (
+	BalanceDeposit  = "deposit"
+	BalanceTransfer = "transfer"
+	BalanceRefund   = "refund"
+	// BalanceSettlement credits merchant account with amount of completed payment
+	BalanceSettlement = "settlement"
+	BalanceReward     = "reward"
+	// BalanceWithdrawal debits withdrawn amount and credits it back when withdrawal fails
+	BalanceWithdrawal = "withdrawal"
+	// BalanceBonus is part of payment amount which was paid from bonus balance instead of account balance
+	BalanceBonus = "bonus"
+	// BalanceOpening sets absolute balance of imported account, payments created before it are already included
+	BalanceOpening = "opening"
+)
+
+// BalanceRecord is a change of account balance which is not a payment, Export writes them to ledger.dump
+type BalanceRecord struct {
+	AccountID int64
+	Amount    types.Money
+	Time      time.Time
+	Kind      string
+}
+
+// kinds of reconciliation issues
+const (
+	IssueDuplicateAccount  = "duplicate_account_id"
+	IssueDuplicatePhone    = "duplicate_phone"
+	IssueDuplicatePayment  = "duplicate_payment_id"
+	IssueDuplicateFavorite = "duplicate_favorite_id"
+	IssueOrphanedPayment   = "orphaned_payment"
+	IssueOrphanedFavorite  = "orphaned_favorite"
+	IssueInvalidStatus     = "invalid_status"
+	IssueInvalidAmount     = "invalid_amount"
+	IssueNegativeBalance   = "negative_balance"
+	IssueClosedWithBalance = "closed_with_balance"
+	IssueBalanceMismatch   = "balance_mismatch"
+)
+
+// ReconcileIssue describes single inconsistency found by reconciliation
+type ReconcileIssue struct {
+	Kind      string      `json:"kind"`
+	ID        string      `json:"id,omitempty"`
+	AccountID int64       `json:"accountId,omitempty"`
+	Expected  types.Money `json:"expected,omitempty"`
+	Actual    types.Money `json:"actual,omitempty"`
+	Detail    string      `json:"detail"`
+}
+
+// ReconcileReport is a machine-readable result of reconciliation.
+// Balances are checked only when history of balance changes is known
+type ReconcileReport struct {
+	Accounts        int              `json:"accounts"`
+	Payments        int              `json:"payments"`
+	Favorites       int              `json:"favorites"`
+	BalancesChecked bool             `json:"balancesChecked"`
+	Issues          []ReconcileIssue `json:"issues"`
+}
+
+// OK reports whether no issues were found
+func (r *ReconcileReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// WriteJSON writes report as indented JSON
+func (r *ReconcileReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(r)
+}
+
+func (r *ReconcileReport) add(issue ReconcileIssue) {
+	r.Issues = append(r.Issues, issue)
+}
+
+// Reconcile checks accounts, payments and favorites for duplicate ids, orphaned records and impossible values.
+// When history is not nil, balance of every account is recomputed from it and from payments:
+// the last opening balance plus deposits, transfers and refunds after it minus payments created after it
+func Reconcile(accounts []types.Account, payments []types.Payment, favorites []types.Favorite, history []BalanceRecord) *ReconcileReport {
+	report := &ReconcileReport{
+		Accounts:        len(accounts),
+		Payments:        len(payments),
+		Favorites:       len(favorites),
+		BalancesChecked: history != nil,
+		Issues:          []ReconcileIssue{},
+	}
+
+	known := make(map[int64]bool, len(accounts))
+	phones := make(map[types.Phone]bool, len(accounts))
+	for _, account := range accounts {
+		id := strconv.FormatInt(account.ID, 10)
+
+		if known[account.ID] {
+			report.add(ReconcileIssue{Kind: IssueDuplicateAccount, ID: id, AccountID: account.ID,
+				Detail: "account id is used more than once"})
+		}
+		known[account.ID] = true
+
+		if phones[account.Phone] {
+			report.add(ReconcileIssue{Kind: IssueDuplicatePhone, ID: id, AccountID: account.ID,
+				Detail: fmt.Sprintf("phone %s is registered more than once", account.Phone)})
+		}
+		phones[account.Phone] = true
+
+		switch account.Status {
+		case "", types.AccountStatusActive, types.AccountStatusFrozen:
+		case types.AccountStatusClosed:
+			if account.Balance != 0 {
+				report.add(ReconcileIssue{Kind: IssueClosedWithBalance, ID: id, AccountID: account.ID,
+					Actual: account.Balance, Detail: "closed account has non-zero balance"})
+			}
+		default:
+			report.add(ReconcileIssue{Kind: IssueInvalidStatus, ID: id, AccountID: account.ID,
+				Detail: fmt.Sprintf("unknown account status %q", account.Status)})
+		}
+
+		if account.Balance < 0 {
+			report.add(ReconcileIssue{Kind: IssueNegativeBalance, ID: id, AccountID: account.ID,
+				Actual: account.Balance, Detail: "account balance is negative"})
+		}
+	}
+
+	paymentIDs := make(map[string]bool, len(payments))
+	for _, payment := range payments {
+		if paymentIDs[payment.ID] {
+			report.add(ReconcileIssue{Kind: IssueDuplicatePayment, ID: payment.ID, AccountID: payment.AccountID,
+				Detail: "payment id is used more than once"})
+		}
+		paymentIDs[payment.ID] = true
+
+		if !known[payment.AccountID] {
+			report.add(ReconcileIssue{Kind: IssueOrphanedPayment, ID: payment.ID, AccountID: payment.AccountID,
+				Detail: "payment belongs to unknown account"})
+		}
+
+		switch payment.Status {
+		case types.PaymentStatusOk, types.PaymentStatusFail, types.PaymentStatusInProgress:
+		default:
+			report.add(ReconcileIssue{Kind: IssueInvalidStatus, ID: payment.ID, AccountID: payment.AccountID,
+				Detail: fmt.Sprintf("unknown payment status %q", payment.Status)})
+		}
+
+		if payment.Amount <= 0 {
+			report.add(ReconcileIssue{Kind: IssueInvalidAmount, ID: payment.ID, AccountID: payment.AccountID,
+				Actual: payment.Amount, Detail: "payment amount is not positive"})
+		}
+	}
+
+	favoriteIDs := make(map[string]bool, len(favorites))
+	for _, favorite := range favorites {
+		if favoriteIDs[favorite.ID] {
+			report.add(ReconcileIssue{Kind: IssueDuplicateFavorite, ID: favorite.ID, AccountID: favorite.AccountID,
+				Detail: "favorite id is used more than once"})
+		}
+		favoriteIDs[favorite.ID] = true
+
+		if !known[favorite.AccountID] {
+			report.add(ReconcileIssue{Kind: IssueOrphanedFavorite, ID: favorite.ID, AccountID: favorite.AccountID,
+				Detail: "favorite belongs to unknown account"})
+		}
+
+		if favorite.Amount <= 0 {
+			report.add(ReconcileIssue{Kind: IssueInvalidAmount, ID: favorite.ID, AccountID: favorite.AccountID,
+				Actual: favorite.Amount, Detail: "favorite amount is not positive"})
+		}
+	}
+
+	if history != nil {
+		expected := expectedBalances(payments, history)
+		for _, account := range accounts {
+			if want := expected[account.ID]; want != account.Balance {
+				report.add(ReconcileIssue{Kind: IssueBalanceMismatch, ID: strconv.FormatInt(account.ID, 10),
+					AccountID: account.ID, Expected: want, Actual: account.Balance,
+					Detail: "balance does not match deposits and payments"})
+			}
+		}
+	}
+
+	return report
+}
+
+// expectedBalances recomputes balances of accounts from balance history and payments
+func expectedBalances(payments []types.Payment, history []BalanceRecord) map[int64]types.Money {
+	openings := make(map[int64]int)
+	for index, record := range history {
+		if record.Kind == BalanceOpening {
+			openings[record.AccountID] = index
+		}
+	}
+
+	expected := make(map[int64]types.Money)
+	for index, record := range history {
+		if opening, ok := openings[record.AccountID]; ok && index < opening {
+			continue
+		}
+
+		if record.Kind == BalanceOpening {
+			expected[record.AccountID] = record.Amount
+			continue
+		}
+
+		expected[record.AccountID] += record.Amount
+	}
+
+	// rejected payments are counted too, their refunds are in history
+	for _, payment := range payments {
+		if opening, ok := openings[payment.AccountID]; ok && !payment.CreatedAt.After(history[opening].Time) {
+			continue
+		}
+
+		expected[payment.AccountID] -= payment.Amount
+	}
+
+	return expected
+}
+
+// Reconcile checks current state of the service, balances are recomputed from its journal
+func (s *Service) Reconcile() *ReconcileReport {
+	accounts := make([]types.Account, 0, len(s.accounts))
+	for _, account := range s.accounts {
+		accounts = append(accounts, *account)
+	}
+
+	payments := make([]types.Payment, 0, len(s.payments))
+	for _, payment := range s.payments {
+		payments = append(payments, *payment)
+	}
+
+	favorites := make([]types.Favorite, 0, len(s.favorites))
+	for _, favorite := range s.favorites {
+		favorites = append(favorites, *favorite)
+	}
+
+	return Reconcile(accounts, payments, favorites, s.balanceHistory())
+}
+
+// balanceHistory returns changes of balances which are not payments, it is never nil
+func (s *Service) balanceHistory() []BalanceRecord {
+	history := []BalanceRecord{}
+	balances := make(map[string]types.Money)
+
+	for _, entry := range s.journal {
+		for _, posting := range entry.Postings {
+			balances[posting.Account] += posting.Amount
+
+			if strings.HasPrefix(posting.Account, bonusPrefix) && entry.Operation == (PaymentCreated{}).EventType() {
+				accountID, _ := strconv.ParseInt(strings.TrimPrefix(posting.Account, bonusPrefix), 10, 64)
+				history = append(history, BalanceRecord{AccountID: accountID, Amount: -posting.Amount, Time: entry.Time, Kind: BalanceBonus})
+				continue
+			}
+
+			if !strings.HasPrefix(posting.Account, walletPrefix) {
+				continue
+			}
+
+			accountID, _ := strconv.ParseInt(strings.TrimPrefix(posting.Account, walletPrefix), 10, 64)
+			record := BalanceRecord{AccountID: accountID, Amount: posting.Amount, Time: entry.Time}
+
+			switch entry.Operation {
+			case Deposited{}.EventType():
+				record.Kind = BalanceDeposit
+			case Transferred{}.EventType():
+				record.Kind = BalanceTransfer
+			case PaymentRejected{}.EventType():
+				record.Kind = BalanceRefund
+			case PaymentCompleted{}.EventType():
+				record.Kind = BalanceSettlement
+			case RewardRedeemed{}.EventType():
+				record.Kind = BalanceReward
+			case WithdrawalRequested{}.EventType(), WithdrawalFailed{}.EventType():
+				record.Kind = BalanceWithdrawal
+			case AccountImported{}.EventType():
+				record.Kind = BalanceOpening
+				record.Amount = balances[posting.Account]
+			default:
+				continue
+			}
+
+			history = append(history, record)
+		}
+	}
+
+	return history
+}
+
+// ReconcileDumps reconciles accounts.dump, payments.dump and favorites.dump written by Export without importing them,
+// so duplicate records are reported instead of being merged. Balances are checked when ledger.dump exists
+func ReconcileDumps(dir string) (*ReconcileReport, error) {
+	var accounts []types.Account
+	err := readDumpLines(dir+"/accounts.dump", func(line string) {
+		accounts = append(accounts, parseAccountLine(line))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var payments []types.Payment
+	err = readDumpLines(dir+"/payments.dump", func(line string) {
+		payments = append(payments, parsePaymentLine(line))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var favorites []types.Favorite
+	err = readDumpLines(dir+"/favorites.dump", func(line string) {
+		favorites = append(favorites, parseFavoriteLine(line))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var history []BalanceRecord
+	err = readDumpLines(dir+"/ledger.dump", func(line string) {
+		history = append(history, parseBalanceLine(line))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return Reconcile(accounts, payments, favorites, history), nil
+}
+
+// readDumpLines calls fn for every non-empty line of the dump, missing dump is treated as empty
+func readDumpLines(path string, fn func(line string)) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	content, err := readAll(context.Background(), file)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			fn(line)
+		}
+	}
+
+	return nil
+}
+
+// writeLedgerToFile writes balance history to file, the file is written even when history is empty,
+// so ReconcileDumps does not check balances against ledger of previous export
+func writeLedgerToFile(ctx context.Context, filePath string, history []BalanceRecord) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	defer func() {
+		err = file.Close()
+		if err != nil {
+			log.Print(err)
+		}
+	}()
+
+	for index, record := range history {
+		if err := canceled(ctx, index); err != nil {
+			return err
+		}
+
+		nl := ""
+		if index != 0 {
+			nl = "\n"
+		}
+
+		_, err := file.Write([]byte(nl + strconv.FormatInt(record.AccountID, 10) + ";" +
+			strconv.FormatInt(int64(record.Amount), 10) + ";" + formatTime(record.Time) + ";" + record.Kind))
+		if err != nil {
+			log.Print(err)
+			return err
+		}
+	}
+
+	return err
+}
+
+// parseBalanceLine parses line of ledger.dump, missing fields are left zero
+func parseBalanceLine(line string) BalanceRecord {
+	record := BalanceRecord{}
+	words := strings.Split(line, ";")
+
+	for index, word := range words {
+		switch index {
+		case 0:
+			record.AccountID, _ = strconv.ParseInt(word, 10, 64)
+		case 1:
+			amount, _ := strconv.ParseInt(word, 10, 64)
+			record.Amount = types.Money(amount)
+		case 2:
+			record.Time = parseTime(word)
+		case 3:
+			record.Kind = word
+		}
+	}
+
+	return record
+}
@@ -0,0 +1,188 @@
+package wallet
+
+import (
+	"io/ioutil"
+	"sort"
+	"testing"
+	"time"
+)
+
+func issueKinds(report *ReconcileReport) []string {
+	kinds := make([]string, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	sort.Strings(kinds)
+
+	return kinds
+}
+
+func TestReconcileDumps_success(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 30_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.FavoritePayment(payment.ID, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	report, err := ReconcileDumps(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !report.OK() || !report.BalancesChecked || report.Payments != 1 || report.Favorites != 1 {
+		t.Errorf("\ngot > %+v \nwant > clean report with checked balances", report)
+	}
+
+	// imported service keeps reconciling after new payments
+	imported := &Service{}
+	imported.SetClock(clock)
+
+	err = imported.Import(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(time.Minute)
+
+	_, err = imported.Pay(account.ID, 40_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if report := imported.Reconcile(); !report.OK() {
+		t.Errorf("\ngot > %+v \nwant > clean report", report.Issues)
+	}
+}
+
+func TestReconcileDumps_issues(t *testing.T) {
+	dir := t.TempDir()
+
+	dumps := map[string]string{
+		"accounts.dump":  "1;+992000000001;100;0;0;ACTIVE\n1;+992000000002;0;0;0;ACTIVE\n2;+992000000001;-5;0;0;DELETED",
+		"payments.dump":  "p1;1;30;auto;OK;0;0\np1;1;10;auto;DONE;0;0\np2;3;0;auto;OK;0;0",
+		"favorites.dump": "f1;4;auto;30;auto;0;0",
+		"ledger.dump":    "1;100;1;deposit",
+	}
+
+	for name, content := range dumps {
+		err := ioutil.WriteFile(dir+"/"+name, []byte(content), 0666)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	report, err := ReconcileDumps(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want := []string{
+		IssueBalanceMismatch, IssueBalanceMismatch, IssueBalanceMismatch,
+		IssueDuplicateAccount, IssueDuplicatePayment, IssueDuplicatePhone,
+		IssueInvalidAmount, IssueInvalidStatus, IssueInvalidStatus, IssueNegativeBalance,
+		IssueOrphanedFavorite, IssueOrphanedPayment,
+	}
+
+	got := issueKinds(report)
+	if len(got) != len(want) {
+		t.Errorf("\ngot > %v \nwant > %v", got, want)
+		return
+	}
+
+	for index := range want {
+		if got[index] != want[index] {
+			t.Errorf("\ngot > %v \nwant > %v", got, want)
+			return
+		}
+	}
+}
+
+func TestReconcileDumps_emptyHistory(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	dir := t.TempDir()
+
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	svc = &Service{}
+
+	_, err = svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Export(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	report, err := ReconcileDumps(dir)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(report.Issues) != 0 {
+		t.Errorf("\ngot > %v \nwant > no issues", issueKinds(report))
+	}
+}
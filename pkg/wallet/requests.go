@@ -0,0 +1,367 @@
+package wallet
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/MrHakimov/wallet/pkg/messenger"
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of payment requests
+var (
+	ErrPaymentRequestNotFound   = errors.New("payment request not found")
+	ErrPaymentRequestNotPending = errors.New("payment request is not pending")
+	ErrPaymentRequestExpired    = errors.New("payment request is expired")
+	ErrSplitNotFound            = errors.New("split not found")
+	ErrNoParticipants           = errors.New("split has no participants")
+	ErrDuplicateParticipant     = errors.New("phone is listed in split more than once")
+)
+
+// DefaultRequestTTL is lifetime of payment request when it is created with non-positive ttl
+const DefaultRequestTTL = 72 * time.Hour
+
+// PaymentRequestStatus represents state of payment request
+type PaymentRequestStatus string
+
+// payment request statuses
+const (
+	PaymentRequestPending  PaymentRequestStatus = "PENDING"
+	PaymentRequestAccepted PaymentRequestStatus = "ACCEPTED"
+	PaymentRequestDeclined PaymentRequestStatus = "DECLINED"
+	PaymentRequestExpired  PaymentRequestStatus = "EXPIRED"
+)
+
+// PaymentRequest asks owner of Phone to transfer Amount to account AccountID.
+// Phone does not have to be registered until request is accepted
+type PaymentRequest struct {
+	ID        string
+	AccountID int64
+	Phone     types.Phone
+	Amount    types.Money
+	Comment   string
+	Status    PaymentRequestStatus
+	// SplitID is set for requests created by SplitBill
+	SplitID   string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Split is a bill of AccountID shared with other phones, every participant owes Share
+// and the account pays the rest of Total itself
+type Split struct {
+	ID        string
+	AccountID int64
+	Total     types.Money
+	Share     types.Money
+	// Remainder is part of Total which can not be divided equally, it is paid by the account
+	Remainder types.Money
+	Requests  []PaymentRequest
+	Collected types.Money
+}
+
+// SetMessenger sets messenger which notifies users about payment requests, nil disables notifications
+func (s *Service) SetMessenger(m messenger.Messenger) {
+	s.messenger = m
+}
+
+// RequestPayment asks owner of the phone to transfer amount to account, request expires after ttl
+func (s *Service) RequestPayment(accountID int64, phone types.Phone, amount types.Money, comment string, ttl time.Duration) (*PaymentRequest, error) {
+	account, err := s.requester(accountID, []types.Phone{phone})
+	if err != nil {
+		return nil, err
+	}
+
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	return s.request(account, phone, amount, comment, "", ttl)
+}
+
+// SplitBill splits total equally between account and the phones and requests share of every phone,
+// remainder of division is paid by account. Every phone may be listed once
+func (s *Service) SplitBill(accountID int64, total types.Money, comment string, ttl time.Duration, phones ...types.Phone) (*Split, error) {
+	if len(phones) == 0 {
+		return nil, ErrNoParticipants
+	}
+
+	listed := make(map[types.Phone]bool, len(phones))
+	for _, phone := range phones {
+		if listed[phone] {
+			return nil, ErrDuplicateParticipant
+		}
+		listed[phone] = true
+	}
+
+	account, err := s.requester(accountID, phones)
+	if err != nil {
+		return nil, err
+	}
+
+	share := total / types.Money(len(phones)+1)
+	if share <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	splitID := uuid.New().String()
+	err = s.emit(BillSplit{Split: Split{
+		ID:        splitID,
+		AccountID: account.ID,
+		Total:     total,
+		Share:     share,
+		Remainder: total - share*types.Money(len(phones)+1),
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, phone := range phones {
+		if _, err := s.request(account, phone, share, comment, splitID, ttl); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.FindSplit(splitID)
+}
+
+// FindSplit returns split with its payment requests
+func (s *Service) FindSplit(splitID string) (*Split, error) {
+	var split *Split
+	for _, item := range s.splits {
+		if item.ID == splitID {
+			found := *item
+			split = &found
+			break
+		}
+	}
+
+	if split == nil {
+		return nil, ErrSplitNotFound
+	}
+
+	for _, request := range s.paymentRequests {
+		if request.SplitID != splitID {
+			continue
+		}
+
+		split.Requests = append(split.Requests, *request)
+		if request.Status == PaymentRequestAccepted {
+			split.Collected += request.Amount
+		}
+	}
+
+	return split, nil
+}
+
+// AcceptPaymentRequest transfers amount of pending request from account of its phone to the requester
+func (s *Service) AcceptPaymentRequest(requestID string) error {
+	request, err := s.pendingRequest(requestID)
+	if err != nil {
+		return err
+	}
+
+	payer, err := s.accountByPhone(request.Phone)
+	if err != nil {
+		return err
+	}
+
+	if err := checkAccountStatus(payer); err != nil {
+		return err
+	}
+
+	requester, err := s.FindAccountByID(request.AccountID)
+	if err != nil {
+		return err
+	}
+
+	if err := checkAccountStatus(requester); err != nil {
+		return err
+	}
+
+	if s.availableBalance(payer) < request.Amount {
+		return ErrNotEnoughBalance
+	}
+
+	now := s.now()
+	err = s.emitAt(now, Transferred{FromAccountID: payer.ID, ToAccountID: requester.ID, Amount: request.Amount})
+	if err != nil {
+		return err
+	}
+
+	err = s.emitAt(now, PaymentRequestResolved{RequestID: request.ID, AccountID: request.AccountID, Status: PaymentRequestAccepted})
+	if err != nil {
+		return err
+	}
+
+	s.notify(requester.Phone, string(request.Phone)+" оплатил ваш запрос на "+FormatMoney(request.Amount))
+
+	return nil
+}
+
+// DeclinePaymentRequest declines pending request, nothing is transferred
+func (s *Service) DeclinePaymentRequest(requestID string) error {
+	request, err := s.pendingRequest(requestID)
+	if err != nil {
+		return err
+	}
+
+	err = s.emit(PaymentRequestResolved{RequestID: request.ID, AccountID: request.AccountID, Status: PaymentRequestDeclined})
+	if err != nil {
+		return err
+	}
+
+	s.notifyAccount(request.AccountID, string(request.Phone)+" отклонил ваш запрос на "+FormatMoney(request.Amount))
+
+	return nil
+}
+
+// ExpirePaymentRequests marks pending requests which are past their expiration time as expired and returns them.
+// Expired requests can not be accepted even before ExpirePaymentRequests is called.
+// Requests expired before an error are returned together with it
+func (s *Service) ExpirePaymentRequests() ([]*PaymentRequest, error) {
+	now := s.now()
+
+	var expired []*PaymentRequest
+	for _, request := range s.paymentRequests {
+		if request.Status == PaymentRequestPending && !now.Before(request.ExpiresAt) {
+			err := s.emitAt(now, PaymentRequestResolved{RequestID: request.ID, AccountID: request.AccountID, Status: PaymentRequestExpired})
+			if err != nil {
+				return expired, err
+			}
+			s.notifyAccount(request.AccountID, "Истёк срок запроса к "+string(request.Phone)+" на "+FormatMoney(request.Amount))
+			expired = append(expired, request)
+		}
+	}
+
+	return expired, nil
+}
+
+// FindPaymentRequestByID returns payment request by id
+func (s *Service) FindPaymentRequestByID(requestID string) (*PaymentRequest, error) {
+	for _, request := range s.paymentRequests {
+		if request.ID == requestID {
+			return request, nil
+		}
+	}
+
+	return nil, ErrPaymentRequestNotFound
+}
+
+// PaymentRequests returns requests sent by account and requests sent to phone of account
+func (s *Service) PaymentRequests(accountID int64) (outgoing []PaymentRequest, incoming []PaymentRequest, err error) {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, request := range s.paymentRequests {
+		if request.AccountID == account.ID {
+			outgoing = append(outgoing, *request)
+		}
+
+		if request.Phone == account.Phone {
+			incoming = append(incoming, *request)
+		}
+	}
+
+	return outgoing, incoming, nil
+}
+
+// requester returns active account which requests money from the phones
+func (s *Service) requester(accountID int64, phones []types.Phone) (*types.Account, error) {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAccountStatus(account); err != nil {
+		return nil, err
+	}
+
+	for _, phone := range phones {
+		if phone == account.Phone {
+			return nil, ErrSameAccount
+		}
+	}
+
+	return account, nil
+}
+
+// request publishes new payment request and notifies its phone
+func (s *Service) request(account *types.Account, phone types.Phone, amount types.Money, comment, splitID string, ttl time.Duration) (*PaymentRequest, error) {
+	if ttl <= 0 {
+		ttl = DefaultRequestTTL
+	}
+
+	now := s.now()
+	err := s.emitAt(now, PaymentRequested{Request: PaymentRequest{
+		ID:        uuid.New().String(),
+		AccountID: account.ID,
+		Phone:     phone,
+		Amount:    amount,
+		Comment:   comment,
+		Status:    PaymentRequestPending,
+		SplitID:   splitID,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	text := string(account.Phone) + " запрашивает у вас " + FormatMoney(amount)
+	if comment != "" {
+		text += ": " + comment
+	}
+	s.notify(phone, text)
+
+	return s.paymentRequests[len(s.paymentRequests)-1], nil
+}
+
+// pendingRequest returns request which can be accepted or declined
+func (s *Service) pendingRequest(requestID string) (*PaymentRequest, error) {
+	request, err := s.FindPaymentRequestByID(requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Status != PaymentRequestPending {
+		return nil, ErrPaymentRequestNotPending
+	}
+
+	if !s.now().Before(request.ExpiresAt) {
+		return nil, ErrPaymentRequestExpired
+	}
+
+	return request, nil
+}
+
+func (s *Service) accountByPhone(phone types.Phone) (*types.Account, error) {
+	for _, account := range s.accounts {
+		if account.Phone == phone {
+			return account, nil
+		}
+	}
+
+	return nil, ErrAccountNotFound
+}
+
+// notify sends message to the phone, it is called by commands only, so replayed events notify nobody
+func (s *Service) notify(phone types.Phone, text string) {
+	if s.messenger == nil {
+		return
+	}
+
+	s.messenger.Send(string(phone) + ": " + text)
+}
+
+func (s *Service) notifyAccount(accountID int64, text string) {
+	if account, err := s.FindAccountByID(accountID); err == nil {
+		s.notify(account.Phone, text)
+	}
+}
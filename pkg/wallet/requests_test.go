@@ -0,0 +1,173 @@
+package wallet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+type testMessenger struct {
+	messages []string
+}
+
+func (m *testMessenger) Send(message string) bool {
+	m.messages = append(m.messages, message)
+	return true
+}
+
+func (m *testMessenger) Recieve() (message string, ok bool) {
+	return "", false
+}
+
+func TestService_AcceptPaymentRequest_success(t *testing.T) {
+	clock := NewManualClock(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC))
+	messages := &testMessenger{}
+	svc := &Service{}
+	svc.SetClock(clock)
+	svc.SetMessenger(messages)
+
+	requester, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	request, err := svc.RequestPayment(requester.ID, "+992000000002", 40_00, "кино", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(messages.messages) != 1 || !strings.HasPrefix(messages.messages[0], "+992000000002: +992000000001") {
+		t.Errorf("\ngot > %v \nwant > notification of requested phone", messages.messages)
+	}
+
+	if err := svc.AcceptPaymentRequest(request.ID); err != ErrAccountNotFound {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountNotFound)
+	}
+
+	payer, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.AcceptPaymentRequest(request.ID); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughBalance)
+	}
+
+	err = svc.Deposit(payer.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.AcceptPaymentRequest(request.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.DeclinePaymentRequest(request.ID); err != ErrPaymentRequestNotPending {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPaymentRequestNotPending)
+	}
+
+	if request.Status != PaymentRequestAccepted || payer.Balance != 60_00 || requester.Balance != 40_00 {
+		t.Errorf("\ngot > %v, %v, %v \nwant > accepted request", request.Status, payer.Balance, requester.Balance)
+	}
+
+	if last := messages.messages[len(messages.messages)-1]; !strings.HasPrefix(last, "+992000000001: ") {
+		t.Errorf("\ngot > %v \nwant > notification of requester", last)
+	}
+
+	outgoing, incoming, err := svc.PaymentRequests(payer.ID)
+	if err != nil || len(outgoing) != 0 || len(incoming) != 1 {
+		t.Errorf("\ngot > %v, %v, %v \nwant > one incoming request", outgoing, incoming, err)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_SplitBill_declineAndExpire(t *testing.T) {
+	clock := NewManualClock(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC))
+	messages := &testMessenger{}
+	svc := &Service{}
+	svc.SetClock(clock)
+	svc.SetMessenger(messages)
+
+	var accounts []*types.Account
+	for _, phone := range []types.Phone{"+992000000001", "+992000000002", "+992000000003", "+992000000004"} {
+		account, err := svc.RegisterAccount(phone)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = svc.Deposit(account.ID, 100_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accounts = append(accounts, account)
+	}
+
+	if _, err := svc.SplitBill(accounts[0].ID, 90_00, "ужин", time.Hour, accounts[0].Phone); err != ErrSameAccount {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrSameAccount)
+	}
+
+	if _, err := svc.SplitBill(accounts[0].ID, 90_00, "ужин", time.Hour, accounts[1].Phone, accounts[1].Phone); err != ErrDuplicateParticipant {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrDuplicateParticipant)
+	}
+
+	split, err := svc.SplitBill(accounts[0].ID, 100_03, "ужин", time.Hour, accounts[1].Phone, accounts[2].Phone, accounts[3].Phone)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if split.Share != 25_00 || split.Total != 100_03 || split.Remainder != 3 || len(split.Requests) != 3 || len(messages.messages) != 3 {
+		t.Errorf("\ngot > %+v \nwant > three requests of 2500 and remainder 3", split)
+	}
+
+	err = svc.AcceptPaymentRequest(split.Requests[0].ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.DeclinePaymentRequest(split.Requests[1].ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(time.Hour)
+
+	if err := svc.AcceptPaymentRequest(split.Requests[2].ID); err != ErrPaymentRequestExpired {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPaymentRequestExpired)
+	}
+
+	if expired, err := svc.ExpirePaymentRequests(); err != nil || len(expired) != 1 || expired[0].ID != split.Requests[2].ID {
+		t.Errorf("\ngot > %v \nwant > last request expired", expired)
+	}
+
+	split, err = svc.FindSplit(split.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	statuses := []PaymentRequestStatus{split.Requests[0].Status, split.Requests[1].Status, split.Requests[2].Status}
+	if split.Collected != 25_00 || statuses[0] != PaymentRequestAccepted || statuses[1] != PaymentRequestDeclined || statuses[2] != PaymentRequestExpired {
+		t.Errorf("\ngot > %v, %v \nwant > accepted, declined and expired", split.Collected, statuses)
+	}
+
+	if accounts[0].Balance != 125_00 || len(messages.messages) != 6 {
+		t.Errorf("\ngot > %v, %v \nwant > 12500 and six notifications", accounts[0].Balance, messages.messages)
+	}
+}
@@ -0,0 +1,163 @@
+package wallet
+
+import (
+	"errors"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of rewards
+var (
+	ErrPointsMustBePositive = errors.New("points must be greater that zero")
+	ErrNotEnoughPoints      = errors.New("not enough reward points")
+)
+
+// kinds of reward history entries
+const (
+	RewardAccrual  = "accrual"
+	RewardClawback = "clawback"
+	RewardRedeem   = "redeem"
+	RewardForfeit  = "forfeit"
+)
+
+// RewardRule accrues amount*BasisPoints/10000 points for completed payments of the category,
+// empty category matches all categories. Fees and part of payment paid from bonus balance are never rewarded
+type RewardRule struct {
+	Category    types.PaymentCategory
+	BasisPoints int64
+}
+
+// RewardEntry is a single change of reward points of account
+type RewardEntry struct {
+	AccountID int64
+	Time      time.Time
+	Kind      string
+	PaymentID string
+	Points    int64
+	// Amount is money deposited to account when points are redeemed
+	Amount types.Money
+}
+
+// SetRewardRules replaces reward rules, the first rule which matches category of payment is used
+func (s *Service) SetRewardRules(rules ...RewardRule) {
+	s.rewardRules = rules
+}
+
+// SetPointValue sets money deposited for one redeemed point, default value is one minimal unit of money,
+// so points work as cashback
+func (s *Service) SetPointValue(value types.Money) {
+	s.pointValue = value
+}
+
+// RewardBalance returns reward points of account, it is negative when points were redeemed before clawback
+func (s *Service) RewardBalance(accountID int64) (int64, error) {
+	_, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.rewardPoints[accountID], nil
+}
+
+// RewardHistory returns changes of reward points of account in order they happened
+func (s *Service) RewardHistory(accountID int64) ([]RewardEntry, error) {
+	_, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []RewardEntry
+	for _, entry := range s.rewardHistory {
+		if entry.AccountID == accountID {
+			history = append(history, entry)
+		}
+	}
+
+	return history, nil
+}
+
+// RedeemRewards converts points into deposit to account and returns deposited amount
+func (s *Service) RedeemRewards(accountID int64, points int64) (types.Money, error) {
+	if points <= 0 {
+		return 0, ErrPointsMustBePositive
+	}
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := checkAccountStatus(account); err != nil {
+		return 0, err
+	}
+
+	if s.rewardPoints[account.ID] < points {
+		return 0, ErrNotEnoughPoints
+	}
+
+	value := s.pointValue
+	if value == 0 {
+		value = 1
+	}
+
+	amount := types.Money(points) * value
+	err = s.emit(RewardRedeemed{AccountID: account.ID, Points: points, Amount: amount})
+	if err != nil {
+		return 0, err
+	}
+
+	return amount, nil
+}
+
+// accrueRewards publishes reward for completed payment
+func (s *Service) accrueRewards(payment *types.Payment) error {
+	if payment.ParentID != "" {
+		return nil
+	}
+
+	for _, rule := range s.rewardRules {
+		if rule.Category != "" && rule.Category != payment.Category {
+			continue
+		}
+
+		points := int64(payment.Amount-s.paymentBonus[payment.ID]) * rule.BasisPoints / 10_000
+		if points > 0 {
+			return s.emit(RewardAccrued{AccountID: payment.AccountID, PaymentID: payment.ID, Points: points})
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// clawbackRewards publishes clawback of reward accrued for rejected payment
+func (s *Service) clawbackRewards(payment *types.Payment) error {
+	if points := s.rewardedPayments[payment.ID]; points > 0 {
+		return s.emit(RewardClawedBack{AccountID: payment.AccountID, PaymentID: payment.ID, Points: points})
+	}
+
+	return nil
+}
+
+// applyReward changes reward points, it is called by apply
+func (s *Service) applyReward(entry RewardEntry) {
+	if s.rewardPoints == nil {
+		s.rewardPoints = make(map[int64]int64)
+		s.rewardedPayments = make(map[string]int64)
+	}
+
+	switch entry.Kind {
+	case RewardAccrual:
+		s.rewardPoints[entry.AccountID] += entry.Points
+		s.rewardedPayments[entry.PaymentID] = entry.Points
+	case RewardClawback:
+		s.rewardPoints[entry.AccountID] -= entry.Points
+		delete(s.rewardedPayments, entry.PaymentID)
+	case RewardRedeem, RewardForfeit:
+		s.rewardPoints[entry.AccountID] -= entry.Points
+	}
+
+	s.rewardHistory = append(s.rewardHistory, entry)
+}
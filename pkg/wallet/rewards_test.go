@@ -0,0 +1,179 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestService_RedeemRewards_success(t *testing.T) {
+	svc := &Service{}
+	svc.SetRewardRules(RewardRule{Category: "food", BasisPoints: 500}, RewardRule{BasisPoints: 100})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	food, err := svc.Pay(account.ID, 200_00, "food")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	auto, err := svc.Pay(account.ID, 300_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if points, _ := svc.RewardBalance(account.ID); points != 0 {
+		t.Errorf("\ngot > %v \nwant > no points before payments are completed", points)
+	}
+
+	for _, id := range []string{food.ID, auto.ID} {
+		err = svc.Settle(id)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if points, _ := svc.RewardBalance(account.ID); points != 10_00+3_00 {
+		t.Errorf("\ngot > %v \nwant > %v", points, 13_00)
+	}
+
+	if _, err := svc.RedeemRewards(account.ID, 14_00); err != ErrNotEnoughPoints {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughPoints)
+	}
+
+	amount, err := svc.RedeemRewards(account.ID, 13_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if amount != 13_00 || account.Balance != 500_00+13_00 {
+		t.Errorf("\ngot > amount %v, balance %v \nwant > 1300, 51300", amount, account.Balance)
+	}
+
+	history, _ := svc.RewardHistory(account.ID)
+	if len(history) != 3 || history[2].Kind != RewardRedeem || history[0].PaymentID != food.ID {
+		t.Errorf("\ngot > %+v \nwant > two accruals and redeem", history)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_Reject_clawbackRewards(t *testing.T) {
+	svc := &Service{}
+	svc.SetEventStore(&MemoryEventStore{})
+	svc.SetRewardRules(RewardRule{BasisPoints: 1000})
+	svc.SetPointValue(10)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 1000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	first, err := svc.Pay(account.ID, 100_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	second, err := svc.Pay(account.ID, 50_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	svc.SettleAll()
+
+	amount, err := svc.RedeemRewards(account.ID, 10_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if amount != 100_00 {
+		t.Errorf("\ngot > %v \nwant > %v", amount, 100_00)
+	}
+
+	for _, id := range []string{first.ID, second.ID} {
+		err = svc.Reject(id)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if points, _ := svc.RewardBalance(account.ID); points != -10_00 {
+		t.Errorf("\ngot > %v \nwant > %v", points, -10_00)
+	}
+
+	rebuilt, err := Rebuild(svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if points, _ := rebuilt.RewardBalance(account.ID); points != -10_00 {
+		t.Errorf("\ngot > %v \nwant > %v after rebuild", points, -10_00)
+	}
+}
+
+func TestService_Settle_bonusNotRewarded(t *testing.T) {
+	svc := &Service{}
+	svc.SetRewardRules(RewardRule{BasisPoints: 1000})
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 30_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.DepositWithPromo(account.ID, 100_00, "welcome")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 50_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Settle(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if points, _ := svc.RewardBalance(account.ID); points != 2_00 {
+		t.Errorf("\ngot > %v \nwant > %v for 2000 paid from balance", points, 2_00)
+	}
+}
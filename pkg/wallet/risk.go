@@ -0,0 +1,241 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of risk checks
+var (
+	ErrPaymentDenied  = errors.New("payment denied by risk check")
+	ErrPaymentNotHeld = errors.New("payment is not held for review")
+	ErrPaymentHeld    = errors.New("payment is held for review")
+)
+
+// RiskDecision is a result of the risk check, greater value is more severe
+type RiskDecision int
+
+// risk decisions
+const (
+	RiskAllow RiskDecision = iota
+	RiskHold
+	RiskDeny
+)
+
+func (d RiskDecision) String() string {
+	switch d {
+	case RiskAllow:
+		return "allow"
+	case RiskHold:
+		return "hold"
+	case RiskDeny:
+		return "deny"
+	}
+
+	return fmt.Sprintf("RiskDecision(%d)", int(d))
+}
+
+// RiskRequest describes payment which is about to be made
+type RiskRequest struct {
+	Account  types.Account
+	Amount   types.Money
+	Category types.PaymentCategory
+	Time     time.Time
+	// History contains previous payments of the account which were not rejected, fees are not included
+	History []types.Payment
+}
+
+// RiskAssessment is a decision of the risk checker with human readable reasons
+type RiskAssessment struct {
+	Decision RiskDecision
+	Reasons  []string
+}
+
+// RiskChecker is consulted by Pay, Repeat and PayFromFavorite before account is debited.
+// Denied payments are not created, held payments are created in INPROGRESS status and wait for review
+type RiskChecker interface {
+	CheckRisk(request RiskRequest) RiskAssessment
+}
+
+// RiskError is returned when payment is denied by risk checker
+type RiskError struct {
+	AccountID int64
+	Reasons   []string
+}
+
+func (e *RiskError) Error() string {
+	return fmt.Sprintf("account %d: payment denied: %s", e.AccountID, strings.Join(e.Reasons, "; "))
+}
+
+// Is makes errors.Is(err, ErrPaymentDenied) true for every RiskError
+func (e *RiskError) Is(target error) bool {
+	return target == ErrPaymentDenied
+}
+
+// SetRiskChecker sets checker consulted before every payment, nil disables risk checks
+func (s *Service) SetRiskChecker(checker RiskChecker) {
+	s.risk = checker
+}
+
+func (s *Service) checkRisk(account *types.Account, amount types.Money, category types.PaymentCategory) RiskAssessment {
+	if s.risk == nil {
+		return RiskAssessment{Decision: RiskAllow}
+	}
+
+	request := RiskRequest{Account: *account, Amount: amount, Category: category, Time: s.now()}
+	for _, payment := range s.payments {
+		if payment.AccountID == account.ID && payment.Status != types.PaymentStatusFail && payment.ParentID == "" {
+			request.History = append(request.History, *payment)
+		}
+	}
+
+	return s.risk.CheckRisk(request)
+}
+
+// RiskRule is a single rule of RuleEngine, empty reason is allowed for RiskAllow
+type RiskRule interface {
+	Evaluate(request RiskRequest) (RiskDecision, string)
+}
+
+// RiskRuleFunc allows to use ordinary functions as risk rules
+type RiskRuleFunc func(request RiskRequest) (RiskDecision, string)
+
+// Evaluate calls f(request)
+func (f RiskRuleFunc) Evaluate(request RiskRequest) (RiskDecision, string) {
+	return f(request)
+}
+
+// RuleEngine evaluates all rules, the most severe decision wins and reasons of all triggered rules are kept
+type RuleEngine struct {
+	Rules []RiskRule
+}
+
+// CheckRisk implements RiskChecker
+func (e *RuleEngine) CheckRisk(request RiskRequest) RiskAssessment {
+	assessment := RiskAssessment{Decision: RiskAllow}
+
+	for _, rule := range e.Rules {
+		decision, reason := rule.Evaluate(request)
+		if decision == RiskAllow {
+			continue
+		}
+
+		if decision > assessment.Decision {
+			assessment.Decision = decision
+		}
+		assessment.Reasons = append(assessment.Reasons, reason)
+	}
+
+	return assessment
+}
+
+// AmountAboveAverage triggers when amount is greater than Multiplier times average payment of the account.
+// Accounts with less than MinPayments payments are not checked
+type AmountAboveAverage struct {
+	Multiplier  int64
+	MinPayments int
+	Decision    RiskDecision
+}
+
+// Evaluate implements RiskRule
+func (r AmountAboveAverage) Evaluate(request RiskRequest) (RiskDecision, string) {
+	if len(request.History) == 0 || len(request.History) < r.MinPayments {
+		return RiskAllow, ""
+	}
+
+	var total types.Money
+	for _, payment := range request.History {
+		total += payment.Amount
+	}
+	average := total / types.Money(len(request.History))
+
+	if request.Amount <= average*types.Money(r.Multiplier) {
+		return RiskAllow, ""
+	}
+
+	return r.Decision, fmt.Sprintf("amount %s is more than %d times average %s",
+		FormatMoney(request.Amount), r.Multiplier, FormatMoney(average))
+}
+
+// NewAccountAmount triggers when account younger than MaxAge pays more than MaxAmount
+type NewAccountAmount struct {
+	MaxAge    time.Duration
+	MaxAmount types.Money
+	Decision  RiskDecision
+}
+
+// Evaluate implements RiskRule
+func (r NewAccountAmount) Evaluate(request RiskRequest) (RiskDecision, string) {
+	if request.Amount <= r.MaxAmount || request.Time.Sub(request.Account.CreatedAt) >= r.MaxAge {
+		return RiskAllow, ""
+	}
+
+	return r.Decision, fmt.Sprintf("account younger than %v pays %s which is more than %s",
+		r.MaxAge, FormatMoney(request.Amount), FormatMoney(r.MaxAmount))
+}
+
+// HeldPayment is a payment waiting for manual review
+type HeldPayment struct {
+	PaymentID string
+	AccountID int64
+	Reasons   []string
+	HeldAt    time.Time
+}
+
+// ReviewQueue returns payments held for review in order they were held
+func (s *Service) ReviewQueue() []HeldPayment {
+	queue := make([]HeldPayment, 0, len(s.held))
+	for _, held := range s.held {
+		queue = append(queue, *held)
+	}
+
+	return queue
+}
+
+// ApprovePayment completes payment held for review, payment of registered merchant is settled
+func (s *Service) ApprovePayment(paymentID string) error {
+	held, err := s.findHeld(paymentID)
+	if err != nil {
+		return err
+	}
+
+	payment, err := s.FindPaymentByID(held.PaymentID)
+	if err != nil {
+		return err
+	}
+
+	return s.complete(payment)
+}
+
+// RejectHeldPayment rejects payment held for review and returns its amount to account
+func (s *Service) RejectHeldPayment(paymentID string) error {
+	_, err := s.findHeld(paymentID)
+	if err != nil {
+		return err
+	}
+
+	return s.Reject(paymentID)
+}
+
+func (s *Service) findHeld(paymentID string) (*HeldPayment, error) {
+	for _, held := range s.held {
+		if held.PaymentID == paymentID {
+			return held, nil
+		}
+	}
+
+	return nil, ErrPaymentNotHeld
+}
+
+func (s *Service) removeHeld(paymentID string) {
+	for index, held := range s.held {
+		if held.PaymentID == paymentID {
+			s.held = append(s.held[:index], s.held[index+1:]...)
+			return
+		}
+	}
+}
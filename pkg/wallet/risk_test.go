@@ -0,0 +1,172 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+func TestService_Pay_riskDenied(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+	svc.SetEventStore(&MemoryEventStore{})
+	svc.SetRiskChecker(&RuleEngine{Rules: []RiskRule{
+		AmountAboveAverage{Multiplier: 3, MinPayments: 2, Decision: RiskHold},
+		NewAccountAmount{MaxAge: 24 * time.Hour, MaxAmount: 1000_00, Decision: RiskDeny},
+	}})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 10_000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 2000_00, "auto")
+	var riskErr *RiskError
+	if !errors.As(err, &riskErr) || len(riskErr.Reasons) != 1 || !errors.Is(err, ErrPaymentDenied) {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPaymentDenied)
+	}
+
+	if account.Balance != 10_000_00 || len(svc.payments) != 0 {
+		t.Errorf("\ngot > balance %v, %v payments \nwant > nothing debited", account.Balance, len(svc.payments))
+	}
+
+	clock.Advance(48 * time.Hour)
+
+	_, err = svc.Pay(account.ID, 2000_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestService_Pay_riskHold(t *testing.T) {
+	svc := &Service{}
+	svc.SetClock(NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)))
+	svc.SetEventStore(&MemoryEventStore{})
+	svc.SetRiskChecker(&RuleEngine{Rules: []RiskRule{
+		AmountAboveAverage{Multiplier: 3, MinPayments: 2, Decision: RiskHold},
+		NewAccountAmount{MaxAge: 24 * time.Hour, MaxAmount: 1000_00, Decision: RiskDeny},
+	}})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 10_000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, amount := range []types.Money{100_00, 200_00} {
+		_, err := svc.Pay(account.ID, amount, "food")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	if len(svc.ReviewQueue()) != 0 {
+		t.Errorf("\ngot > %v \nwant > empty queue", svc.ReviewQueue())
+	}
+
+	approved, err := svc.Pay(account.ID, 500_00, "food")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rejected, err := svc.Pay(account.ID, 900_00, "food")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	queue := svc.ReviewQueue()
+	if len(queue) != 2 || queue[0].PaymentID != approved.ID || queue[1].PaymentID != rejected.ID {
+		t.Errorf("\ngot > %+v \nwant > both payments held", queue)
+		return
+	}
+
+	err = svc.ApprovePayment(approved.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.RejectHeldPayment(rejected.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if approved.Status != types.PaymentStatusOk || rejected.Status != types.PaymentStatusFail {
+		t.Errorf("\ngot > %v, %v \nwant > %v, %v", approved.Status, rejected.Status, types.PaymentStatusOk, types.PaymentStatusFail)
+	}
+
+	if len(svc.ReviewQueue()) != 0 {
+		t.Errorf("\ngot > %v \nwant > empty queue", svc.ReviewQueue())
+	}
+
+	if err := svc.ApprovePayment(approved.ID); err != ErrPaymentNotHeld {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrPaymentNotHeld)
+	}
+
+	if want := types.Money(10_000_00 - 100_00 - 200_00 - 500_00); account.Balance != want {
+		t.Errorf("\ngot > %v \nwant > %v", account.Balance, want)
+	}
+}
+
+func TestService_ReviewQueue_replay(t *testing.T) {
+	svc := &Service{}
+	svc.SetClock(NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)))
+	svc.SetEventStore(&MemoryEventStore{})
+	svc.SetRiskChecker(&RuleEngine{Rules: []RiskRule{
+		AmountAboveAverage{Multiplier: 3, MinPayments: 2, Decision: RiskHold},
+		NewAccountAmount{MaxAge: 24 * time.Hour, MaxAmount: 1000_00, Decision: RiskDeny},
+	}})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 10_000_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for _, amount := range []types.Money{100_00, 100_00, 900_00} {
+		_, err := svc.Pay(account.ID, amount, "food")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	rebuilt, err := Rebuild(svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	queue := rebuilt.ReviewQueue()
+	if len(queue) != 1 || len(queue[0].Reasons) != 1 {
+		t.Errorf("\ngot > %+v \nwant > one held payment", queue)
+	}
+}
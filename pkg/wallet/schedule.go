@@ -0,0 +1,373 @@
+package wallet
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Errors of scheduled payments
+var (
+	ErrInvalidSchedule          = errors.New("invalid schedule")
+	ErrScheduledPaymentNotFound = errors.New("scheduled payment not found")
+)
+
+// Schedule returns time of the next run strictly after given time, zero time means there are no more runs
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func (i intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(i.interval)
+}
+
+// Every returns schedule which runs with fixed interval
+func Every(interval time.Duration) (Schedule, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidSchedule
+	}
+
+	return intervalSchedule{interval: interval}, nil
+}
+
+// cronSchedule keeps allowed values of every field as bit sets
+type cronSchedule struct {
+	minute, hour, day, month, weekday uint64
+	anyDay, anyWeekday                bool
+}
+
+// cronBounds are minimal and maximal values of minute, hour, day of month, month and day of week
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// ParseCron parses standard five-field cron expression "minute hour day-of-month month day-of-week".
+// Fields support *, lists, ranges and steps, e.g. "0 9 1 * *" runs at 09:00 on the first day of every month
+func ParseCron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, ErrInvalidSchedule
+	}
+
+	var sets [5]uint64
+	for index, field := range fields {
+		set, err := parseCronField(field, cronBounds[index][0], cronBounds[index][1])
+		if err != nil {
+			return nil, err
+		}
+
+		sets[index] = set
+	}
+
+	// both 0 and 7 mean sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &cronSchedule{
+		minute:     sets[0],
+		hour:       sets[1],
+		day:        sets[2],
+		month:      sets[3],
+		weekday:    sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); index >= 0 {
+			value, err := strconv.Atoi(part[index+1:])
+			if err != nil || value <= 0 {
+				return 0, ErrInvalidSchedule
+			}
+
+			step = value
+			part = part[:index]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			value, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, ErrInvalidSchedule
+			}
+
+			from, to = value, value
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, ErrInvalidSchedule
+				}
+			} else if step != 1 {
+				to = max
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return 0, ErrInvalidSchedule
+		}
+
+		for value := from; value <= to; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+
+	return set, nil
+}
+
+// cronSearchLimit stops search of the next run for expressions which never match, e.g. "0 0 30 2 *"
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// matchesDay follows cron rule: when both day of month and day of week are restricted, either of them matches
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	day := c.day&(1<<uint(t.Day())) != 0
+	weekday := c.weekday&(1<<uint(t.Weekday())) != 0
+
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+
+	return day || weekday
+}
+
+// MissedRunPolicy tells what to do with runs which were missed while RunDuePayments was not called
+type MissedRunPolicy int
+
+// missed run policies
+const (
+	// MissedRunOnce makes a single payment for all missed runs
+	MissedRunOnce MissedRunPolicy = iota
+	// MissedRunCatchUp makes a payment for every missed run
+	MissedRunCatchUp
+	// MissedRunSkip makes no payments for missed runs and waits for the next one
+	MissedRunSkip
+)
+
+// RetryPolicy tells how many times and how often payments failed with ErrNotEnoughBalance are retried
+type RetryPolicy struct {
+	MaxRetries int
+	Interval   time.Duration
+}
+
+// ScheduledPayment repeats payment of a favorite by schedule
+type ScheduledPayment struct {
+	ID         string
+	FavoriteID string
+	Schedule   Schedule
+	Policy     MissedRunPolicy
+	Retry      RetryPolicy
+	NextRun    time.Time
+	Active     bool
+
+	attempts int
+	retryAt  time.Time
+}
+
+// ScheduledRun is a result of a single run of the scheduled payment
+type ScheduledRun struct {
+	ScheduleID  string
+	ScheduledAt time.Time
+	RanAt       time.Time
+	Attempt     int
+	PaymentID   string
+	Skipped     bool
+	Err         error
+}
+
+// SchedulePayment creates payment of the favorite which is made by RunDuePayments according to schedule
+func (s *Service) SchedulePayment(favoriteID string, schedule Schedule, policy MissedRunPolicy, retry RetryPolicy) (*ScheduledPayment, error) {
+	_, err := s.FindFavoriteByID(favoriteID)
+	if err != nil {
+		return nil, ErrFavoriteNotFound
+	}
+
+	if schedule == nil {
+		return nil, ErrInvalidSchedule
+	}
+
+	next := schedule.Next(s.now())
+	if next.IsZero() {
+		return nil, ErrInvalidSchedule
+	}
+
+	scheduled := &ScheduledPayment{
+		ID:         uuid.New().String(),
+		FavoriteID: favoriteID,
+		Schedule:   schedule,
+		Policy:     policy,
+		Retry:      retry,
+		NextRun:    next,
+		Active:     true,
+	}
+
+	s.schedules = append(s.schedules, scheduled)
+
+	return scheduled, nil
+}
+
+// FindScheduledPaymentByID returns scheduled payment by id
+func (s *Service) FindScheduledPaymentByID(scheduleID string) (*ScheduledPayment, error) {
+	for _, scheduled := range s.schedules {
+		if scheduled.ID == scheduleID {
+			return scheduled, nil
+		}
+	}
+
+	return nil, ErrScheduledPaymentNotFound
+}
+
+// CancelScheduledPayment stops further runs of the scheduled payment
+func (s *Service) CancelScheduledPayment(scheduleID string) error {
+	scheduled, err := s.FindScheduledPaymentByID(scheduleID)
+	if err != nil {
+		return err
+	}
+
+	scheduled.Active = false
+
+	return nil
+}
+
+// ScheduledRuns returns history of runs of the scheduled payment
+func (s *Service) ScheduledRuns(scheduleID string) []ScheduledRun {
+	var runs []ScheduledRun
+	for _, run := range s.scheduledRuns {
+		if run.ScheduleID == scheduleID {
+			runs = append(runs, run)
+		}
+	}
+
+	return runs
+}
+
+// RunDuePayments makes all scheduled payments which are due at the current time of the service clock
+// and returns results of the runs
+func (s *Service) RunDuePayments() []ScheduledRun {
+	now := s.now()
+
+	var runs []ScheduledRun
+	for _, scheduled := range s.schedules {
+		for scheduled.Active {
+			run, ok := s.runScheduled(scheduled, now)
+			if !ok {
+				break
+			}
+
+			runs = append(runs, run...)
+		}
+	}
+
+	s.scheduledRuns = append(s.scheduledRuns, runs...)
+
+	return runs
+}
+
+// runScheduled handles a single due occurrence or retry, false means nothing is due
+func (s *Service) runScheduled(scheduled *ScheduledPayment, now time.Time) ([]ScheduledRun, bool) {
+	if !scheduled.retryAt.IsZero() {
+		if scheduled.retryAt.After(now) {
+			return nil, false
+		}
+
+		return []ScheduledRun{s.payScheduled(scheduled, now)}, true
+	}
+
+	if scheduled.NextRun.IsZero() || scheduled.NextRun.After(now) {
+		return nil, false
+	}
+
+	var runs []ScheduledRun
+
+	// occurrence is missed when the next one is already due too
+	next := scheduled.Schedule.Next(scheduled.NextRun)
+	if scheduled.Policy != MissedRunCatchUp && !next.IsZero() && !next.After(now) {
+		for !next.IsZero() && !next.After(now) {
+			runs = append(runs, ScheduledRun{ScheduleID: scheduled.ID, ScheduledAt: scheduled.NextRun, RanAt: now, Skipped: true})
+			scheduled.NextRun = next
+			next = scheduled.Schedule.Next(next)
+		}
+
+		if scheduled.Policy == MissedRunSkip {
+			runs = append(runs, ScheduledRun{ScheduleID: scheduled.ID, ScheduledAt: scheduled.NextRun, RanAt: now, Skipped: true})
+			scheduled.NextRun = next
+			s.finishScheduled(scheduled)
+
+			return runs, true
+		}
+	}
+
+	return append(runs, s.payScheduled(scheduled, now)), true
+}
+
+func (s *Service) payScheduled(scheduled *ScheduledPayment, now time.Time) ScheduledRun {
+	scheduled.attempts++
+
+	run := ScheduledRun{ScheduleID: scheduled.ID, ScheduledAt: scheduled.NextRun, RanAt: now, Attempt: scheduled.attempts}
+
+	payment, err := s.PayFromFavorite(scheduled.FavoriteID)
+	if err == nil {
+		run.PaymentID = payment.ID
+	}
+	run.Err = err
+
+	if err == ErrNotEnoughBalance && scheduled.attempts <= scheduled.Retry.MaxRetries && scheduled.Retry.Interval > 0 {
+		scheduled.retryAt = now.Add(scheduled.Retry.Interval)
+		return run
+	}
+
+	scheduled.NextRun = scheduled.Schedule.Next(scheduled.NextRun)
+	s.finishScheduled(scheduled)
+
+	return run
+}
+
+func (s *Service) finishScheduled(scheduled *ScheduledPayment) {
+	scheduled.attempts = 0
+	scheduled.retryAt = time.Time{}
+
+	if scheduled.NextRun.IsZero() {
+		scheduled.Active = false
+	}
+}
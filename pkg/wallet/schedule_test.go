@@ -0,0 +1,191 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_next(t *testing.T) {
+	schedule, err := ParseCron("30 9 1 * *")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	next := schedule.Next(time.Date(2020, time.January, 31, 12, 0, 0, 0, time.UTC))
+	want := time.Date(2020, time.February, 1, 9, 30, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("\ngot > %v \nwant > %v", next, want)
+	}
+
+	schedule, err = ParseCron("0 */6 * * 1-5")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// saturday evening, next run is monday midnight
+	next = schedule.Next(time.Date(2020, time.March, 7, 19, 0, 0, 0, time.UTC))
+	want = time.Date(2020, time.March, 9, 0, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("\ngot > %v \nwant > %v", next, want)
+	}
+
+	for _, expr := range []string{"* * *", "60 * * * *", "a * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(expr); err != ErrInvalidSchedule {
+			t.Errorf("ParseCron(%q): got > %v want > %v", expr, err, ErrInvalidSchedule)
+		}
+	}
+}
+
+func countPaid(runs []ScheduledRun) int {
+	paid := 0
+	for _, run := range runs {
+		if run.PaymentID != "" {
+			paid++
+		}
+	}
+
+	return paid
+}
+
+func TestService_RunDuePayments_missedRuns(t *testing.T) {
+	for _, test := range []struct {
+		policy MissedRunPolicy
+		paid   int
+	}{
+		{MissedRunCatchUp, 3},
+		{MissedRunOnce, 1},
+		{MissedRunSkip, 0},
+	} {
+		clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+		svc := &Service{}
+		svc.SetClock(clock)
+
+		account, err := svc.RegisterAccount("+992000000001")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		err = svc.Deposit(account.ID, 1010_00)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		payment, err := svc.Pay(account.ID, 10_00, "megafon")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		favorite, err := svc.FavoritePayment(payment.ID, "megafon")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		schedule, _ := Every(24 * time.Hour)
+		scheduled, err := svc.SchedulePayment(favorite.ID, schedule, test.policy, RetryPolicy{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		clock.Advance(3*24*time.Hour + time.Minute)
+
+		runs := svc.RunDuePayments()
+		if countPaid(runs) != test.paid {
+			t.Errorf("policy %v: got > %v payments want > %v", test.policy, countPaid(runs), test.paid)
+		}
+
+		if !scheduled.NextRun.Equal(time.Date(2020, time.March, 5, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("policy %v: got > next run %v", test.policy, scheduled.NextRun)
+		}
+
+		history, err := svc.ExportAccountHistory(favorite.AccountID)
+		if err != nil || len(history) != test.paid+1 {
+			t.Errorf("policy %v: got > %v payments in history want > %v", test.policy, len(history), test.paid+1)
+		}
+	}
+}
+
+func TestService_RunDuePayments_retry(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 10_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	favorite, err := svc.FavoritePayment(payment.ID, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	schedule, _ := Every(24 * time.Hour)
+	scheduled, err := svc.SchedulePayment(favorite.ID, schedule, MissedRunOnce, RetryPolicy{MaxRetries: 2, Interval: time.Hour})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(24 * time.Hour)
+
+	runs := svc.RunDuePayments()
+	if len(runs) != 1 || runs[0].Err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %+v \nwant > run failed with %v", runs, ErrNotEnoughBalance)
+	}
+
+	err = svc.Deposit(favorite.AccountID, 10_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(30 * time.Minute)
+	if runs := svc.RunDuePayments(); len(runs) != 0 {
+		t.Errorf("\ngot > %+v \nwant > retry is not due yet", runs)
+	}
+
+	clock.Advance(30 * time.Minute)
+
+	runs = svc.RunDuePayments()
+	if len(runs) != 1 || runs[0].Attempt != 2 || runs[0].PaymentID == "" {
+		t.Errorf("\ngot > %+v \nwant > successful second attempt", runs)
+	}
+
+	if len(svc.ScheduledRuns(scheduled.ID)) != 2 {
+		t.Errorf("\ngot > %v \nwant > 2 runs in history", len(svc.ScheduledRuns(scheduled.ID)))
+	}
+
+	err = svc.CancelScheduledPayment(scheduled.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(48 * time.Hour)
+	if runs := svc.RunDuePayments(); len(runs) != 0 {
+		t.Errorf("\ngot > %+v \nwant > no runs after cancel", runs)
+	}
+}
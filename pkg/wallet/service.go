@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/MrHakimov/wallet/pkg/messenger"
 	"github.com/MrHakimov/wallet/pkg/types"
 )
 
@@ -31,6 +33,7 @@ var (
 	ErrPaymentNotFound      = errors.New("payment not found")
 	ErrFavoriteNotFound     = errors.New("favorite not found")
 	ErrFileNotFound         = errors.New("file not found")
+	ErrPaymentRejected      = errors.New("payment already rejected")
 )
 
 // Service represents type for storing accounts and payments
@@ -39,6 +42,49 @@ type Service struct {
 	accounts      []*types.Account
 	payments      []*types.Payment
 	favorites     []*types.Favorite
+	events        *eventBus
+	seq           uint64
+	eventStore    EventStore
+	audit         *AuditTrail
+	actor         string
+	clock         Clock
+	schedules     []*ScheduledPayment
+	scheduledRuns []ScheduledRun
+
+	accountLimits  map[int64]Limits
+	categoryLimits map[types.PaymentCategory]Limits
+	risk           RiskChecker
+	held           []*HeldPayment
+	holds          []*Hold
+	journal        []JournalEntry
+	merchants      map[types.PaymentCategory]*Merchant
+	strict         bool
+	settlements    map[string]int64
+	feeSchedules   map[feeKey]FeeSchedule
+	tiers          map[int64]AccountTier
+
+	rewardRules      []RewardRule
+	pointValue       types.Money
+	rewardPoints     map[int64]int64
+	rewardedPayments map[string]int64
+	rewardHistory    []RewardEntry
+
+	promos        map[string]*PromoCampaign
+	promoSpent    map[string]types.Money
+	promoRedeemed map[promoKey]types.Money
+	bonus         map[int64]types.Money
+	paymentBonus  map[string]types.Money
+
+	payouts        PayoutProvider
+	withdrawals    []*Withdrawal
+	payoutAccounts map[int64]int64
+
+	messenger       messenger.Messenger
+	paymentRequests []*PaymentRequest
+	splits          []*Split
+
+	pockets        []*Pocket
+	paymentPockets map[string]string
 }
 
 // RegisterAccount is used to register user by phone number
@@ -49,17 +95,20 @@ func (s *Service) RegisterAccount(phone types.Phone) (*types.Account, error) {
 		}
 	}
 
-	s.nextAccountID++
-
-	account := &types.Account{
-		ID:      s.nextAccountID,
-		Phone:   phone,
-		Balance: 0,
+	now := s.now()
+	err := s.emitAt(now, AccountRegistered{Account: types.Account{
+		ID:        s.nextAccountID + 1,
+		Phone:     phone,
+		Balance:   0,
+		Status:    types.AccountStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}})
+	if err != nil {
+		return nil, err
 	}
 
-	s.accounts = append(s.accounts, account)
-
-	return account, nil
+	return s.accounts[len(s.accounts)-1], nil
 }
 
 // Deposit is used to create deposits
@@ -80,12 +129,21 @@ func (s *Service) Deposit(accountID int64, amount types.Money) error {
 		return ErrAccountNotFound
 	}
 
-	account.Balance += amount
-	return nil
+	if err := checkAccountStatus(account); err != nil {
+		return err
+	}
+
+	return s.emit(Deposited{AccountID: account.ID, Amount: amount})
 }
 
 // Pay is used for payments
 func (s *Service) Pay(accountID int64, amount types.Money, category types.PaymentCategory) (*types.Payment, error) {
+	return s.pay(accountID, amount, category, MainPocket, nil)
+}
+
+// pay creates payment paid from the pocket of account, bonus balance is spent only by payments from the main pocket.
+// Payment which captures hold is paid from funds reserved by the hold, which used limits when it was authorized
+func (s *Service) pay(accountID int64, amount types.Money, category types.PaymentCategory, pocket string, hold *Hold) (*types.Payment, error) {
 	if amount <= 0 {
 		return nil, ErrAmountMustBePositive
 	}
@@ -102,22 +160,92 @@ func (s *Service) Pay(accountID int64, amount types.Money, category types.Paymen
 		return nil, ErrAccountNotFound
 	}
 
-	if account.Balance < amount {
+	if err := checkAccountStatus(account); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkMerchant(amount, category); err != nil {
+		return nil, err
+	}
+
+	if hold == nil {
+		if err := s.checkLimits(account.ID, amount, category); err != nil {
+			return nil, err
+		}
+	}
+
+	available, err := s.pocketAvailable(account, pocket)
+	if err != nil {
+		return nil, err
+	}
+
+	if hold != nil {
+		available += hold.Amount
+	}
+
+	fee := s.feeFor(account.ID, amount, category)
+	var bonus types.Money
+	if pocket == MainPocket {
+		bonus = s.bonusFor(account.ID, amount)
+	}
+
+	if available < amount-bonus+fee {
 		return nil, ErrNotEnoughBalance
 
 	}
-	account.Balance -= amount
+
+	assessment := s.checkRisk(account, amount, category)
+	if assessment.Decision == RiskDeny {
+		return nil, &RiskError{AccountID: account.ID, Reasons: assessment.Reasons}
+	}
 
 	paymentID := uuid.New().String()
-	payment := &types.Payment{
+	now := s.now()
+	if hold != nil {
+		err = s.emitAt(now, HoldCaptured{HoldID: hold.ID, AccountID: hold.AccountID, PaymentID: paymentID, Amount: amount})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.emitAt(now, PaymentCreated{Payment: types.Payment{
 		ID:        paymentID,
 		AccountID: accountID,
 		Amount:    amount,
 		Category:  category,
 		Status:    types.PaymentStatusInProgress,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, Bonus: bonus, Pocket: pocket})
+	if err != nil {
+		return nil, err
+	}
+
+	payment := s.payments[len(s.payments)-1]
+
+	if fee > 0 {
+		err = s.emitAt(now, PaymentCreated{Payment: types.Payment{
+			ID:        uuid.New().String(),
+			AccountID: accountID,
+			Amount:    fee,
+			Category:  FeeCategory,
+			Status:    types.PaymentStatusInProgress,
+			CreatedAt: now,
+			UpdatedAt: now,
+			ParentID:  paymentID,
+		}, Pocket: pocket})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if assessment.Decision == RiskHold {
+		err = s.emitAt(now, PaymentHeld{PaymentID: paymentID, AccountID: accountID, Reasons: assessment.Reasons})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	s.payments = append(s.payments, payment)
 	return payment, nil
 
 }
@@ -155,7 +283,9 @@ func (s *Service) FindFavoriteByID(favoriteID string) (*types.Favorite, error) {
 	return nil, ErrFavoriteNotFound
 }
 
-// Reject is used to reject payments
+// Reject is used to reject payments, fees charged for the payment are rejected too.
+// Payments of closed accounts can not be rejected, their refund would be lost in the closed account.
+// Settled payment is taken back from settlement account, which must be active and have enough available balance
 func (s *Service) Reject(paymentID string) error {
 	payment, err := s.FindPaymentByID(paymentID)
 
@@ -163,7 +293,9 @@ func (s *Service) Reject(paymentID string) error {
 		return ErrPaymentNotFound
 	}
 
-	payment.Status = types.PaymentStatusFail
+	if payment.Status == types.PaymentStatusFail {
+		return ErrPaymentRejected
+	}
 
 	account, err := s.FindAccountByID(payment.AccountID)
 
@@ -171,7 +303,44 @@ func (s *Service) Reject(paymentID string) error {
 		return ErrAccountNotFound
 	}
 
-	account.Balance += payment.Amount
+	if account.Status == types.AccountStatusClosed {
+		return ErrAccountClosed
+	}
+
+	if settlementID := s.settlements[payment.ID]; settlementID != 0 {
+		merchant, err := s.FindAccountByID(settlementID)
+		if err != nil {
+			return err
+		}
+
+		if err := checkAccountStatus(merchant); err != nil {
+			return err
+		}
+
+		if s.availableBalance(merchant) < payment.Amount {
+			return ErrNotEnoughBalance
+		}
+	}
+
+	err = s.clawbackRewards(payment)
+	if err != nil {
+		return err
+	}
+
+	err = s.emit(PaymentRejected{PaymentID: payment.ID, AccountID: account.ID, Amount: payment.Amount,
+		SettlementAccountID: s.settlements[payment.ID], Bonus: s.paymentBonus[payment.ID], Pocket: s.paymentPockets[payment.ID]})
+	if err != nil {
+		return err
+	}
+
+	for _, fee := range s.fees(payment.ID) {
+		if fee.Status != types.PaymentStatusFail {
+			err := s.emit(PaymentRejected{PaymentID: fee.ID, AccountID: fee.AccountID, Amount: fee.Amount, Pocket: s.paymentPockets[fee.ID]})
+			if err != nil {
+				return err
+			}
+		}
+	}
 
 	return nil
 }
@@ -201,16 +370,21 @@ func (s *Service) FavoritePayment(paymentID string, name string) (*types.Favorit
 	}
 
 	favoriteID := uuid.New().String()
-	favorite := &types.Favorite{
+	now := s.now()
+	err = s.emitAt(now, FavoriteCreated{Favorite: types.Favorite{
 		ID:        favoriteID,
 		AccountID: payment.AccountID,
 		Name:      name,
 		Amount:    payment.Amount,
 		Category:  payment.Category,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}})
+	if err != nil {
+		return nil, err
 	}
 
-	s.favorites = append(s.favorites, favorite)
-	return favorite, nil
+	return s.favorites[len(s.favorites)-1], nil
 }
 
 // PayFromFavorite is just a wrapper for Pay
@@ -224,7 +398,7 @@ func (s *Service) PayFromFavorite(favoriteID string) (*types.Payment, error) {
 	payment, err := s.Pay(favorite.AccountID, favorite.Amount, favorite.Category)
 
 	if err != nil {
-		return nil, ErrPaymentNotFound
+		return nil, err
 	}
 
 	return payment, nil
@@ -318,35 +492,64 @@ func (s *Service) ImportFromFile(path string) error {
 			return err
 		}
 
-		s.accounts = append(s.accounts, &types.Account{
+		err = s.emit(AccountImported{Account: types.Account{
 			ID:      ID,
 			Phone:   types.Phone(item[1]),
 			Balance: types.Money(balance),
-		})
+			Status:  types.AccountStatusActive,
+		}})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// Export is used to save all payments, accounts and favorites into file
+// Export is used to save all payments, accounts, favorites, pockets and redeemed promo codes into file,
+// balance changes which are not payments are saved to ledger.dump for reconciliation
 func (s *Service) Export(dir string) error {
-	err := WriteAccountsToFile(dir+"/accounts.dump", s.accounts)
+	return s.ExportContext(context.Background(), dir)
+}
+
+// ExportContext is the same as Export, but stops writing and returns ctx.Err() when ctx is canceled
+func (s *Service) ExportContext(ctx context.Context, dir string) error {
+	err := writeAccountsToFile(ctx, dir+"/accounts.dump", s.accounts, s.accountDumpLine)
 	if err != nil {
 		return err
 	}
 
-	err = WritePaymentsToFile(dir+"/payments.dump", s.payments)
+	err = writePaymentsToFile(ctx, dir+"/payments.dump", s.payments, s.paymentDumpLine)
 	if err != nil {
 		return err
 	}
 
-	err = WriteFavoritesToFile(dir+"/favorites.dump", s.favorites)
+	err = writeFavoritesToFile(ctx, dir+"/favorites.dump", s.favorites)
+	if err != nil {
+		return err
+	}
+
+	err = writePocketsToFile(ctx, dir+"/pockets.dump", s.pockets)
+	if err != nil {
+		return err
+	}
+
+	err = s.writePromosToFile(ctx, dir+"/promos.dump")
+	if err != nil {
+		return err
+	}
+
+	err = writeLedgerToFile(ctx, dir+"/ledger.dump", s.balanceHistory())
 
 	return err
 }
 
 // WriteAccountsToFile is a helper function to write accounts to respective file
 func WriteAccountsToFile(filePath string, accounts []*types.Account) error {
+	return writeAccountsToFile(context.Background(), filePath, accounts, accountLine)
+}
+
+func writeAccountsToFile(ctx context.Context, filePath string, accounts []*types.Account, line func(types.Account) string) error {
 	if len(accounts) == 0 {
 		return nil
 	}
@@ -365,13 +568,16 @@ func WriteAccountsToFile(filePath string, accounts []*types.Account) error {
 	}()
 
 	for index, account := range accounts {
+		if err := canceled(ctx, index); err != nil {
+			return err
+		}
+
 		nl := ""
 		if index != 0 {
 			nl = "\n"
 		}
 
-		_, err := file.Write([]byte(nl + strconv.FormatInt(account.ID, 10) + ";" +
-			string(account.Phone) + ";" + strconv.FormatInt(int64(account.Balance), 10)))
+		_, err := file.Write([]byte(nl + line(*account)))
 
 		if err != nil {
 			log.Print(err)
@@ -384,6 +590,10 @@ func WriteAccountsToFile(filePath string, accounts []*types.Account) error {
 
 // WritePaymentsToFile is a helper function to write payments to respective file
 func WritePaymentsToFile(filePath string, payments []*types.Payment) error {
+	return writePaymentsToFile(context.Background(), filePath, payments, paymentLine)
+}
+
+func writePaymentsToFile(ctx context.Context, filePath string, payments []*types.Payment, line func(types.Payment) string) error {
 	if len(payments) == 0 {
 		return nil
 	}
@@ -402,14 +612,16 @@ func WritePaymentsToFile(filePath string, payments []*types.Payment) error {
 	}()
 
 	for index, payment := range payments {
+		if err := canceled(ctx, index); err != nil {
+			return err
+		}
+
 		nl := ""
 		if index != 0 {
 			nl = "\n"
 		}
 
-		_, err := file.Write([]byte(nl + payment.ID + ";" + strconv.FormatInt(payment.AccountID, 10) + ";" +
-			strconv.FormatInt(int64(payment.Amount), 10) + ";" + string(payment.Category) + ";" +
-			string(payment.Status)))
+		_, err := file.Write([]byte(nl + line(*payment)))
 
 		if err != nil {
 			log.Print(err)
@@ -422,6 +634,10 @@ func WritePaymentsToFile(filePath string, payments []*types.Payment) error {
 
 // WriteFavoritesToFile is a helper function to write favorite payments to respective file
 func WriteFavoritesToFile(filePath string, favorites []*types.Favorite) error {
+	return writeFavoritesToFile(context.Background(), filePath, favorites)
+}
+
+func writeFavoritesToFile(ctx context.Context, filePath string, favorites []*types.Favorite) error {
 	if len(favorites) == 0 {
 		return nil
 	}
@@ -440,6 +656,10 @@ func WriteFavoritesToFile(filePath string, favorites []*types.Favorite) error {
 	}()
 
 	for index, favorite := range favorites {
+		if err := canceled(ctx, index); err != nil {
+			return err
+		}
+
 		nl := ""
 		if index != 0 {
 			nl = "\n"
@@ -447,7 +667,7 @@ func WriteFavoritesToFile(filePath string, favorites []*types.Favorite) error {
 
 		_, err := file.Write([]byte(nl + favorite.ID + ";" + strconv.FormatInt(favorite.AccountID, 10) + ";" +
 			favorite.Name + ";" + strconv.FormatInt(int64(favorite.Amount), 10) + ";" +
-			string(favorite.Category)))
+			string(favorite.Category) + ";" + formatTime(favorite.CreatedAt) + ";" + formatTime(favorite.UpdatedAt)))
 
 		if err != nil {
 			log.Print(err)
@@ -458,8 +678,217 @@ func WriteFavoritesToFile(filePath string, favorites []*types.Favorite) error {
 	return err
 }
 
-// Import is used to update accounts, payments and favorites state from given files
+// accountLine is used to write account to dump files
+func accountLine(account types.Account) string {
+	return strconv.FormatInt(account.ID, 10) + ";" + string(account.Phone) + ";" +
+		strconv.FormatInt(int64(account.Balance), 10) + ";" + formatTime(account.CreatedAt) + ";" +
+		formatTime(account.UpdatedAt) + ";" + string(account.Status)
+}
+
+// accountDumpLine is accountLine followed by payout account of closed account and bonus balance, it is used by Export
+func (s *Service) accountDumpLine(account types.Account) string {
+	return accountLine(account) + ";" + strconv.FormatInt(s.payoutAccounts[account.ID], 10) + ";" +
+		strconv.FormatInt(int64(s.bonus[account.ID]), 10)
+}
+
+// paymentLine is used to write payment to dump files
+func paymentLine(payment types.Payment) string {
+	return payment.ID + ";" + strconv.FormatInt(payment.AccountID, 10) + ";" +
+		strconv.FormatInt(int64(payment.Amount), 10) + ";" + string(payment.Category) + ";" +
+		string(payment.Status) + ";" + formatTime(payment.CreatedAt) + ";" + formatTime(payment.UpdatedAt) + ";" +
+		payment.ParentID
+}
+
+// paymentDumpLine is paymentLine followed by settlement account, bonus part and pocket of the payment,
+// it is used by Export
+func (s *Service) paymentDumpLine(payment types.Payment) string {
+	return paymentLine(payment) + ";" + strconv.FormatInt(s.settlements[payment.ID], 10) + ";" +
+		strconv.FormatInt(int64(s.paymentBonus[payment.ID]), 10) + ";" + s.paymentPockets[payment.ID]
+}
+
+// readAll reads the whole file checking ctx between chunks
+func readAll(ctx context.Context, file *os.File) ([]byte, error) {
+	content := make([]byte, 0)
+	buffer := make([]byte, 32*1024)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		read, err := file.Read(buffer)
+		content = append(content, buffer[:read]...)
+
+		if err == io.EOF {
+			return content, nil
+		}
+
+		if err != nil {
+			log.Print(err)
+			return nil, err
+		}
+	}
+}
+
+// parseAccountLine parses line of accounts.dump, missing fields are left zero
+func parseAccountLine(line string) types.Account {
+	account := types.Account{}
+	words := strings.Split(line, ";")
+
+	for index, word := range words {
+		switch index {
+		case 0:
+			id, _ := strconv.ParseInt(word, 10, 64)
+			account.ID = id
+			break
+		case 1:
+			account.Phone = types.Phone(word)
+			break
+		case 2:
+			balance, _ := strconv.ParseInt(word, 10, 64)
+			account.Balance = types.Money(balance)
+			break
+		case 3:
+			account.CreatedAt = parseTime(word)
+			break
+		case 4:
+			account.UpdatedAt = parseTime(word)
+			break
+		case 5:
+			account.Status = types.AccountStatus(word)
+			break
+		}
+	}
+
+	return account
+}
+
+// parseAccountImport parses line of accounts.dump written by Export, which keeps payout account
+// of closed account and bonus balance
+func parseAccountImport(line string) AccountImported {
+	event := AccountImported{Account: parseAccountLine(line)}
+	words := strings.Split(line, ";")
+
+	if len(words) > 6 {
+		event.PayoutAccountID, _ = strconv.ParseInt(words[6], 10, 64)
+	}
+
+	if len(words) > 7 {
+		bonus, _ := strconv.ParseInt(words[7], 10, 64)
+		event.Bonus = types.Money(bonus)
+	}
+
+	if event.Account.Status == "" {
+		event.Account.Status = types.AccountStatusActive
+	}
+
+	return event
+}
+
+// parsePaymentLine parses line of payments.dump, missing fields are left zero
+func parsePaymentLine(line string) types.Payment {
+	payment := types.Payment{}
+	words := strings.Split(line, ";")
+
+	for index, word := range words {
+		switch index {
+		case 0:
+			payment.ID = word
+			break
+		case 1:
+			accountID, _ := strconv.ParseInt(word, 10, 64)
+			payment.AccountID = int64(accountID)
+			break
+		case 2:
+			balance, _ := strconv.ParseInt(word, 10, 64)
+			payment.Amount = types.Money(balance)
+			break
+		case 3:
+			payment.Category = types.PaymentCategory(word)
+			break
+		case 4:
+			payment.Status = types.PaymentStatus(word)
+			break
+		case 5:
+			payment.CreatedAt = parseTime(word)
+			break
+		case 6:
+			payment.UpdatedAt = parseTime(word)
+			break
+		case 7:
+			payment.ParentID = word
+			break
+		}
+	}
+
+	return payment
+}
+
+// parsePaymentImport parses line of payments.dump written by Export, which keeps settlement account,
+// bonus part and pocket of the payment
+func parsePaymentImport(line string) PaymentImported {
+	event := PaymentImported{Payment: parsePaymentLine(line)}
+	words := strings.Split(line, ";")
+
+	if len(words) > 8 {
+		event.SettlementAccountID, _ = strconv.ParseInt(words[8], 10, 64)
+	}
+
+	if len(words) > 9 {
+		bonus, _ := strconv.ParseInt(words[9], 10, 64)
+		event.Bonus = types.Money(bonus)
+	}
+
+	if len(words) > 10 {
+		event.Pocket = words[10]
+	}
+
+	return event
+}
+
+// parseFavoriteLine parses line of favorites.dump, missing fields are left zero
+func parseFavoriteLine(line string) types.Favorite {
+	favorite := types.Favorite{}
+	words := strings.Split(line, ";")
+	for index, word := range words {
+		switch index {
+		case 0:
+			favorite.ID = word
+			break
+		case 1:
+			accountID, _ := strconv.ParseInt(word, 10, 64)
+			favorite.AccountID = int64(accountID)
+			break
+		case 2:
+			favorite.Name = word
+			break
+		case 3:
+			balance, _ := strconv.ParseInt(word, 10, 64)
+			favorite.Amount = types.Money(balance)
+			break
+		case 4:
+			favorite.Category = types.PaymentCategory(word)
+			break
+		case 5:
+			favorite.CreatedAt = parseTime(word)
+			break
+		case 6:
+			favorite.UpdatedAt = parseTime(word)
+			break
+		}
+	}
+
+	return favorite
+}
+
+// Import is used to update accounts, payments, favorites, pockets and redeemed promo codes state from given files
 func (s *Service) Import(dir string) error {
+	return s.ImportContext(context.Background(), dir)
+}
+
+// ImportContext is the same as Import, but stops reading and returns ctx.Err() when ctx is canceled.
+// Records read before cancellation stay imported
+func (s *Service) ImportContext(ctx context.Context, dir string) error {
 	fileAccounts, err := os.Open(dir + "/accounts.dump")
 
 	if err != nil {
@@ -475,52 +904,20 @@ func (s *Service) Import(dir string) error {
 			}
 		}()
 
-		content := make([]byte, 0)
-		buffer := make([]byte, 4)
-
-		for {
-			read, err := fileAccounts.Read(buffer)
-			if err == io.EOF {
-				break
-			}
-
-			content = append(content, buffer[:read]...)
+		content, err := readAll(ctx, fileAccounts)
+		if err != nil {
+			return err
 		}
 
 		data := strings.Split(string(content), "\n")
 
-		for _, line := range data {
-			account := &types.Account{}
-			words := strings.Split(line, ";")
-
-			for index, word := range words {
-				switch index {
-				case 0:
-					id, _ := strconv.ParseInt(word, 10, 64)
-					account.ID = id
-					break
-				case 1:
-					account.Phone = types.Phone(word)
-					break
-				case 2:
-					balance, _ := strconv.ParseInt(word, 10, 64)
-					account.Balance = types.Money(balance)
-					break
-				}
-			}
-
-			exists := false
-			for _, accountCheck := range s.accounts {
-				if accountCheck.ID == account.ID {
-					accountCheck.Phone = account.Phone
-					accountCheck.Balance = account.Balance
-					exists = true
-				}
-
+		for row, line := range data {
+			if err := canceled(ctx, row); err != nil {
+				return err
 			}
 
-			if !exists {
-				s.accounts = append(s.accounts, account)
+			if err := s.emit(parseAccountImport(line)); err != nil {
+				return err
 			}
 		}
 	}
@@ -542,64 +939,61 @@ func (s *Service) Import(dir string) error {
 
 		log.Printf("%#v", filePayments)
 
-		contentPayment := make([]byte, 0)
-		bufferPayment := make([]byte, 4)
+		contentPayment, err := readAll(ctx, filePayments)
+		if err != nil {
+			return err
+		}
+
+		dataPayment := strings.Split(string(contentPayment), "\n")
 
-		for {
-			read, err := filePayments.Read(bufferPayment)
-			if err == io.EOF {
-				break
+		for row, line := range dataPayment {
+			if err := canceled(ctx, row); err != nil {
+				return err
 			}
 
-			contentPayment = append(contentPayment, bufferPayment[:read]...)
+			if err := s.emit(parsePaymentImport(line)); err != nil {
+				return err
+			}
 		}
+	}
 
-		dataPayment := strings.Split(string(contentPayment), "\n")
+	fileFavorites, err := os.Open(dir + "/favorites.dump")
+	if err != nil {
+		log.Print(err)
+		err = ErrFileNotFound
+	}
 
-		for _, line := range dataPayment {
-			payment := &types.Payment{}
-			words := strings.Split(line, ";")
-
-			for index, word := range words {
-				switch index {
-				case 0:
-					payment.ID = word
-					break
-				case 1:
-					accountID, _ := strconv.ParseInt(word, 10, 64)
-					payment.AccountID = int64(accountID)
-					break
-				case 2:
-					balance, _ := strconv.ParseInt(word, 10, 64)
-					payment.Amount = types.Money(balance)
-					break
-				case 3:
-					payment.Category = types.PaymentCategory(word)
-					break
-				case 4:
-					payment.Status = types.PaymentStatus(word)
-					break
-				}
+	if err != ErrFileNotFound {
+		defer func() {
+			err := fileFavorites.Close()
+			if err != nil {
+				log.Print(err)
 			}
+		}()
 
-			exists := false
-			for _, paymentCheck := range s.payments {
-				if paymentCheck.ID == payment.ID {
-					paymentCheck.AccountID = payment.AccountID
-					paymentCheck.Amount = payment.Amount
-					paymentCheck.Category = payment.Category
-					paymentCheck.Status = payment.Status
-					exists = true
-				}
+		log.Printf("%#v", fileFavorites)
+
+		contentFavorite, err := readAll(ctx, fileFavorites)
+		if err != nil {
+			return err
+		}
+
+		dataFavorite := strings.Split(string(contentFavorite), "\n")
+
+		for row, line := range dataFavorite {
+			if err := canceled(ctx, row); err != nil {
+				return err
 			}
 
-			if !exists {
-				s.payments = append(s.payments, payment)
+			favorite := parseFavoriteLine(line)
+
+			if err := s.emit(FavoriteImported{Favorite: favorite}); err != nil {
+				return err
 			}
 		}
 	}
 
-	fileFavorites, err := os.Open(dir + "/favorites.dump")
+	filePockets, err := os.Open(dir + "/pockets.dump")
 	if err != nil {
 		log.Print(err)
 		err = ErrFileNotFound
@@ -607,66 +1001,60 @@ func (s *Service) Import(dir string) error {
 
 	if err != ErrFileNotFound {
 		defer func() {
-			err := fileFavorites.Close()
+			err := filePockets.Close()
 			if err != nil {
 				log.Print(err)
 			}
 		}()
 
-		log.Printf("%#v", fileFavorites)
+		contentPocket, err := readAll(ctx, filePockets)
+		if err != nil {
+			return err
+		}
 
-		contentFavorite := make([]byte, 0)
-		bufferFavorite := make([]byte, 4)
+		dataPocket := strings.Split(string(contentPocket), "\n")
 
-		for {
-			read, err := fileFavorites.Read(bufferFavorite)
-			if err == io.EOF {
-				break
+		for row, line := range dataPocket {
+			if err := canceled(ctx, row); err != nil {
+				return err
 			}
 
-			contentFavorite = append(contentFavorite, bufferFavorite[:read]...)
+			if err := s.emit(PocketImported{Pocket: parsePocketLine(line)}); err != nil {
+				return err
+			}
 		}
+	}
 
-		dataFavorite := strings.Split(string(contentFavorite), "\n")
+	filePromos, err := os.Open(dir + "/promos.dump")
+	if err != nil {
+		log.Print(err)
+		err = ErrFileNotFound
+	}
 
-		for _, line := range dataFavorite {
-			favorite := &types.Favorite{}
-			words := strings.Split(line, ";")
-			for index, word := range words {
-				switch index {
-				case 0:
-					favorite.ID = word
-					break
-				case 1:
-					accountID, _ := strconv.ParseInt(word, 10, 64)
-					favorite.AccountID = int64(accountID)
-					break
-				case 2:
-					favorite.Name = word
-					break
-				case 3:
-					balance, _ := strconv.ParseInt(word, 10, 64)
-					favorite.Amount = types.Money(balance)
-					break
-				case 4:
-					favorite.Category = types.PaymentCategory(word)
-					break
-				}
+	if err != ErrFileNotFound {
+		defer func() {
+			err := filePromos.Close()
+			if err != nil {
+				log.Print(err)
 			}
+		}()
+
+		contentPromo, err := readAll(ctx, filePromos)
+		if err != nil {
+			return err
+		}
 
-			exists := false
-			for _, favoriteCheck := range s.favorites {
-				if favoriteCheck.ID == favorite.ID {
-					favoriteCheck.AccountID = favorite.AccountID
-					favoriteCheck.Name = favorite.Name
-					favoriteCheck.Amount = favorite.Amount
-					favoriteCheck.Category = favorite.Category
-					exists = true
+		if len(contentPromo) != 0 {
+			dataPromo := strings.Split(string(contentPromo), "\n")
+
+			for row, line := range dataPromo {
+				if err := canceled(ctx, row); err != nil {
+					return err
 				}
-			}
 
-			if !exists {
-				s.favorites = append(s.favorites, favorite)
+				if err := s.emit(parsePromoLine(line)); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -676,13 +1064,22 @@ func (s *Service) Import(dir string) error {
 
 // ExportAccountHistory returns all payments of given user (by their accountID)
 func (s *Service) ExportAccountHistory(accountID int64) ([]types.Payment, error) {
+	return s.ExportAccountHistoryContext(context.Background(), accountID)
+}
+
+// ExportAccountHistoryContext is the same as ExportAccountHistory, but returns ctx.Err() when ctx is canceled
+func (s *Service) ExportAccountHistoryContext(ctx context.Context, accountID int64) ([]types.Payment, error) {
 	_, err := s.FindAccountByID(accountID)
 	if err != nil {
 		return nil, ErrAccountNotFound
 	}
 
 	var payments []types.Payment = nil
-	for _, payment := range s.payments {
+	for index, payment := range s.payments {
+		if err := canceled(ctx, index); err != nil {
+			return nil, err
+		}
+
 		if payment.AccountID == accountID {
 			payments = append(payments, *payment)
 		}
@@ -697,6 +1094,11 @@ func (s *Service) ExportAccountHistory(accountID int64) ([]types.Payment, error)
 
 // HistoryToFiles is used to create backup files from payments history
 func (s *Service) HistoryToFiles(payments []types.Payment, dir string, records int) error {
+	return s.HistoryToFilesContext(context.Background(), payments, dir, records)
+}
+
+// HistoryToFilesContext is the same as HistoryToFiles, but stops writing and returns ctx.Err() when ctx is canceled
+func (s *Service) HistoryToFilesContext(ctx context.Context, payments []types.Payment, dir string, records int) error {
 	if len(payments) == 0 {
 		return nil
 	}
@@ -712,27 +1114,35 @@ func (s *Service) HistoryToFiles(payments []types.Payment, dir string, records i
 		}()
 
 		var data string
-		for _, account := range payments {
-			data += fmt.Sprint(account.ID) + ";" + fmt.Sprint(account.AccountID) + ";" +
-				fmt.Sprint(account.Amount) + ";" + fmt.Sprint(account.Category) + ";" +
-				fmt.Sprint(account.Status) + "\n"
+		for index, payment := range payments {
+			if err := canceled(ctx, index); err != nil {
+				return err
+			}
+
+			data += paymentLine(payment) + "\n"
 		}
 
-		_, err = file.WriteString("data")
+		_, err = file.WriteString(data)
 	} else {
 		var file *os.File
 		var data string
 		k := 0
 		t := 1
 
-		for _, account := range payments {
+		for index, payment := range payments {
+			if err := canceled(ctx, index); err != nil {
+				if k != 0 {
+					file.Close()
+				}
+
+				return err
+			}
+
 			if k == 0 {
 				file, _ = os.OpenFile(dir+"/payments"+fmt.Sprint(t)+".dump", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 			}
 			k++
-			data = fmt.Sprint(account.ID) + ";" + fmt.Sprint(account.AccountID) + ";" +
-				fmt.Sprint(account.Amount) + ";" + fmt.Sprint(account.Category) + ";" +
-				fmt.Sprint(account.Status) + "\n"
+			data = paymentLine(payment) + "\n"
 
 			_, err = file.Write([]byte(data))
 
@@ -760,79 +1170,72 @@ func Min(x int, y int) int {
 
 // SumPayments calculates the sum of all payments using goroutines
 func (s *Service) SumPayments(goroutines int) types.Money {
-	wg := sync.WaitGroup{}
-	wg.Add(goroutines)
+	result, _ := s.SumPaymentsContext(context.Background(), goroutines)
 
-	mu := sync.Mutex{}
+	return result
+}
+
+// SumPaymentsContext is the same as SumPayments, but returns ctx.Err() when ctx is canceled
+func (s *Service) SumPaymentsContext(ctx context.Context, goroutines int) (types.Money, error) {
 	result := types.Money(0)
 
-	paymentPerGoroutine := len(s.payments) / goroutines
-	if len(s.payments)%goroutines != 0 {
-		paymentPerGoroutine++
+	err := s.MapReducePayments(ctx, goroutines, sumPayments, func(part interface{}) {
+		result += part.(types.Money)
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	for i := 0; i < goroutines; i++ {
-		currentSum := types.Money(0)
-		index := i
-		payments := s.payments
-
-		go func(currentSum types.Money, index int, payments []*types.Payment) {
-			defer wg.Done()
+	return result, nil
+}
 
-			for j := index * paymentPerGoroutine; j < Min((index+1)*paymentPerGoroutine, len(payments)); j++ {
-				currentSum += payments[j].Amount
-			}
+func sumPayments(ctx context.Context, payments []*types.Payment) (interface{}, error) {
+	currentSum := types.Money(0)
+	for index, payment := range payments {
+		if err := canceled(ctx, index); err != nil {
+			return nil, err
+		}
 
-			mu.Lock()
-			result += currentSum
-			mu.Unlock()
-		}(currentSum, index, payments)
+		currentSum += payment.Amount
 	}
 
-	wg.Wait()
-
-	return result
+	return currentSum, nil
 }
 
 // FilterPaymentsByFn accepts filter function and finds all accounts which return true as a filter result
 func (s *Service) FilterPaymentsByFn(filter func(payment types.Payment) bool, goroutines int) ([]types.Payment, error) {
+	return s.FilterPaymentsByFnContext(context.Background(), filter, goroutines)
+}
+
+// FilterPaymentsByFnContext is the same as FilterPaymentsByFn, but returns ctx.Err() when ctx is canceled
+func (s *Service) FilterPaymentsByFnContext(ctx context.Context, filter func(payment types.Payment) bool,
+	goroutines int) ([]types.Payment, error) {
 	if goroutines == 0 {
 		goroutines = 1
 	}
 
-	wg := sync.WaitGroup{}
-	wg.Add(goroutines)
-
-	mu := sync.Mutex{}
 	var result []types.Payment = nil
 
-	paymentPerGoroutine := len(s.payments) / goroutines
-	if len(s.payments)%goroutines != 0 {
-		paymentPerGoroutine++
-	}
-
-	for i := 0; i < goroutines; i++ {
-		var currentAccounts []types.Payment = nil
-		index := i
-		payments := s.payments
-
-		go func(index int) {
-			defer wg.Done()
+	err := s.MapReducePayments(ctx, goroutines, func(ctx context.Context, payments []*types.Payment) (interface{}, error) {
+		var currentPayments []types.Payment = nil
+		for index, payment := range payments {
+			if err := canceled(ctx, index); err != nil {
+				return nil, err
+			}
 
-			for j := index * paymentPerGoroutine; j < Min((index+1)*paymentPerGoroutine, len(payments)); j++ {
-				if filter(*payments[j]) {
-					currentAccounts = append(currentAccounts, *payments[j])
-				}
+			if filter(*payment) {
+				currentPayments = append(currentPayments, *payment)
 			}
+		}
 
-			mu.Lock()
-			result = append(result, currentAccounts...)
-			mu.Unlock()
-		}(index)
+		return currentPayments, nil
+	}, func(part interface{}) {
+		result = append(result, part.([]types.Payment)...)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
-
 	if result == nil {
 		return nil, ErrAccountNotFound
 	}
@@ -840,44 +1243,66 @@ func (s *Service) FilterPaymentsByFn(filter func(payment types.Payment) bool, go
 	return result, nil
 }
 
-var globalAccountID int64
-
-func filterByAccountID(payment types.Payment) bool {
-	return payment.AccountID == globalAccountID
-}
-
 // FilterPayments accepts accountID and finds all accounts with such an ID using goroutines
 func (s *Service) FilterPayments(accountID int64, goroutines int) ([]types.Payment, error) {
-	globalAccountID = accountID
+	return s.FilterPaymentsContext(context.Background(), accountID, goroutines)
+}
 
-	return s.FilterPaymentsByFn(filterByAccountID, goroutines)
+// FilterPaymentsContext is the same as FilterPayments, but returns ctx.Err() when ctx is canceled
+func (s *Service) FilterPaymentsContext(ctx context.Context, accountID int64, goroutines int) ([]types.Payment, error) {
+	return s.FilterPaymentsByFnContext(ctx, func(payment types.Payment) bool {
+		return payment.AccountID == accountID
+	}, goroutines)
 }
 
+// DefaultProgressPartSize is number of payments summed in one part by SumPaymentsWithProgress
+const DefaultProgressPartSize = 100_000
+
 //SumPaymentsWithProgress is used to calculate payments' amount using channels
 func (s *Service) SumPaymentsWithProgress() <-chan types.Progress {
-	ch := make(chan types.Progress, 1)
-	defer close(ch)
+	return s.SumPaymentsWithProgressContext(context.Background(), DefaultProgressPartSize, 0)
+}
 
-	if s.payments == nil {
-		return ch
+// SumPaymentsWithProgressContext sums payments by parts of partSize in parallel workers. Sum of every part is sent
+// as soon as it is calculated, the last message contains total with Done set. The channel is closed after the total,
+// or without it when ctx is canceled
+func (s *Service) SumPaymentsWithProgressContext(ctx context.Context, partSize, workers int) <-chan types.Progress {
+	if partSize <= 0 {
+		partSize = DefaultProgressPartSize
 	}
 
-	wg := sync.WaitGroup{}
-	wg.Add(1)
+	payments := s.payments
+	parts := (len(payments) + partSize - 1) / partSize
 
-	go func(ch chan types.Progress) {
-		defer wg.Done()
+	// buffer holds one message per part and the total, so workers never wait for a slow reader
+	ch := make(chan types.Progress, parts+1)
 
-		sum := types.Progress{}
+	go func() {
+		defer close(ch)
 
-		for _, value := range s.payments {
-			sum.Result += value.Amount
-		}
+		mu := sync.Mutex{}
+		total := types.Money(0)
 
-		ch <- sum
-	}(ch)
+		err := ForEachPart(ctx, len(payments), partSize, workers, func(ctx context.Context, part, from, to int) error {
+			sum, err := sumPayments(ctx, payments[from:to])
+			if err != nil {
+				return err
+			}
 
-	wg.Wait()
+			mu.Lock()
+			total += sum.(types.Money)
+			mu.Unlock()
+
+			ch <- types.Progress{Part: part, Result: sum.(types.Money)}
+
+			return nil
+		})
+		if err != nil {
+			return
+		}
+
+		ch <- types.Progress{Part: parts, Result: total, Done: true}
+	}()
 
 	return ch
 }
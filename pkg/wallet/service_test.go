@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
@@ -315,12 +316,7 @@ func TestService_Export_Success(t *testing.T) {
 		t.Errorf("method Deposit returned not nil error, error => %v", err)
 	}
 
-	wd, err := os.Getwd()
-	if err != nil {
-		t.Error(err)
-	}
-
-	err = svc.Export(wd + "/test1")
+	err = svc.Export(t.TempDir())
 	if err != nil {
 		t.Error(err)
 	}
@@ -411,12 +407,7 @@ func TestService_HistoryToFiles_Success(t *testing.T) {
 
 	payments = append(payments, *payment)
 
-	dir, err := os.Getwd()
-	if err != nil {
-		t.Error(err)
-	}
-
-	err = svc.HistoryToFiles(payments, dir+"/test1", 1)
+	err = svc.HistoryToFiles(payments, t.TempDir(), 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -448,12 +439,7 @@ func TestService_HistoryToFiles_Multiple(t *testing.T) {
 	}
 
 	payments = append(payments, *payment)
-	dir, err := os.Getwd()
-	if err != nil {
-		t.Error(err)
-	}
-
-	err = svc.HistoryToFiles(payments, dir+"/test1", 1)
+	err = svc.HistoryToFiles(payments, t.TempDir(), 1)
 	if err != nil {
 		t.Error(err)
 	}
@@ -523,6 +509,8 @@ func BenchmarkSumPayments(b *testing.B) {
 	}
 }
 
+var globalAccountID int64
+
 // testFilter is just a test function
 func testFilter(payment types.Payment) bool {
 	return payment.AccountID == globalAccountID
@@ -585,3 +573,93 @@ func TestService_SumPaymentsWithProgress(t *testing.T) {
 
 	svc.SumPaymentsWithProgress()
 }
+
+func TestService_Context_canceled(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 10_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dir := t.TempDir()
+
+	if err := svc.ExportContext(ctx, dir); err != context.Canceled {
+		t.Errorf("ExportContext(): got > %v want > %v", err, context.Canceled)
+	}
+
+	if err := svc.Export(dir); err != nil {
+		t.Error(err)
+		return
+	}
+
+	imported := &Service{}
+	if err := imported.ImportContext(ctx, dir); err != context.Canceled {
+		t.Errorf("ImportContext(): got > %v want > %v", err, context.Canceled)
+	}
+
+	if _, err := svc.ExportAccountHistoryContext(ctx, account.ID); err != context.Canceled {
+		t.Errorf("ExportAccountHistoryContext(): got > %v want > %v", err, context.Canceled)
+	}
+
+	payments := []types.Payment{{ID: "1"}, {ID: "2"}}
+	if err := svc.HistoryToFilesContext(ctx, payments, dir, 1); err != context.Canceled {
+		t.Errorf("HistoryToFilesContext(): got > %v want > %v", err, context.Canceled)
+	}
+
+	if _, err := svc.SumPaymentsContext(ctx, 2); err != context.Canceled {
+		t.Errorf("SumPaymentsContext(): got > %v want > %v", err, context.Canceled)
+	}
+
+	if _, err := svc.FilterPaymentsContext(ctx, account.ID, 2); err != context.Canceled {
+		t.Errorf("FilterPaymentsContext(): got > %v want > %v", err, context.Canceled)
+	}
+}
+
+func TestService_Context_success(t *testing.T) {
+	svc := &Service{}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.Pay(account.ID, 10_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	sum, err := svc.SumPaymentsContext(context.Background(), 2)
+	if err != nil || sum != 10_00 {
+		t.Errorf("\ngot > %v %v \nwant > 1000 nil", sum, err)
+	}
+
+	payments, err := svc.FilterPaymentsContext(context.Background(), account.ID, 2)
+	if err != nil || len(payments) != 1 {
+		t.Errorf("\ngot > %v %v \nwant > 1 payment", payments, err)
+	}
+}
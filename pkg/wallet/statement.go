@@ -0,0 +1,279 @@
+package wallet
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// kinds of statement lines
+const (
+	LineDeposit    = "deposit"
+	LinePayment    = "payment"
+	LineRefund     = "refund"
+	LineTransfer   = "transfer"
+	LineSettlement = "settlement"
+	LineReward     = "reward"
+	LineWithdrawal = "withdrawal"
+	LineAdjustment = "adjustment"
+)
+
+// StatementLine is a single change of account balance
+type StatementLine struct {
+	Time      time.Time             `json:"time"`
+	Kind      string                `json:"kind"`
+	PaymentID string                `json:"payment_id,omitempty"`
+	Category  types.PaymentCategory `json:"category,omitempty"`
+	Amount    types.Money           `json:"amount"`
+	Balance   types.Money           `json:"balance"`
+}
+
+// CategoryTotal is a summary of payments of one category within statement period
+type CategoryTotal struct {
+	Category types.PaymentCategory `json:"category"`
+	Count    int                   `json:"count"`
+	Spent    types.Money           `json:"spent"`
+	Refunded types.Money           `json:"refunded"`
+}
+
+// PocketTotal shows how balance of pocket changed within statement period
+type PocketTotal struct {
+	Name           string      `json:"name"`
+	Goal           types.Money `json:"goal,omitempty"`
+	OpeningBalance types.Money `json:"opening_balance"`
+	ClosingBalance types.Money `json:"closing_balance"`
+}
+
+// Statement shows how balance of the account changed within period, pockets are a part of the balance
+type Statement struct {
+	AccountID      int64           `json:"account_id"`
+	Phone          types.Phone     `json:"phone"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance types.Money     `json:"opening_balance"`
+	Lines          []StatementLine `json:"lines"`
+	Categories     []CategoryTotal `json:"categories"`
+	Pockets        []PocketTotal   `json:"pockets,omitempty"`
+	TotalIn        types.Money     `json:"total_in"`
+	TotalOut       types.Money     `json:"total_out"`
+	ClosingBalance types.Money     `json:"closing_balance"`
+}
+
+// Statement builds statement of the account for period [from, to), zero from or to means the period
+// is not bounded from that side. Statement is built from postings of the wallet in the ledger journal.
+// Pocket history is not kept, so Pockets show current balances of pockets as closing balances
+func (s *Service) Statement(accountID int64, from, to time.Time) (*Statement, error) {
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, ErrAccountNotFound
+	}
+
+	statement := &Statement{AccountID: accountID, Phone: account.Phone, From: from, To: to}
+	categories := make(map[types.PaymentCategory]*CategoryTotal)
+	wallet := WalletLedgerAccount(accountID)
+
+	var balance types.Money
+	for _, entry := range s.journal {
+		if !to.IsZero() && !entry.Time.Before(to) {
+			break
+		}
+
+		var amount types.Money
+		for _, posting := range entry.Postings {
+			if posting.Account == wallet {
+				amount += posting.Amount
+			}
+		}
+		balance += amount
+
+		if !from.IsZero() && entry.Time.Before(from) {
+			statement.OpeningBalance = balance
+			continue
+		}
+
+		if amount == 0 {
+			continue
+		}
+
+		line := StatementLine{Time: entry.Time, Kind: statementKind(entry.Operation), PaymentID: entry.PaymentID,
+			Amount: amount, Balance: balance}
+		if line.PaymentID != "" {
+			if payment, err := s.FindPaymentByID(line.PaymentID); err == nil {
+				line.Category = payment.Category
+			}
+		}
+
+		statement.add(line, categories)
+	}
+
+	statement.ClosingBalance = statement.OpeningBalance + statement.TotalIn - statement.TotalOut
+
+	for _, total := range categories {
+		statement.Categories = append(statement.Categories, *total)
+	}
+
+	sort.Slice(statement.Categories, func(i, j int) bool {
+		return statement.Categories[i].Category < statement.Categories[j].Category
+	})
+
+	pockets, _ := s.Pockets(accountID)
+	for _, pocket := range pockets {
+		statement.Pockets = append(statement.Pockets, PocketTotal{Name: pocket.Name, Goal: pocket.Goal, ClosingBalance: pocket.Balance})
+	}
+
+	return statement, nil
+}
+
+// add appends line to statement and counts it in totals
+func (st *Statement) add(line StatementLine, categories map[types.PaymentCategory]*CategoryTotal) {
+	st.Lines = append(st.Lines, line)
+
+	if line.Amount > 0 {
+		st.TotalIn += line.Amount
+	} else {
+		st.TotalOut -= line.Amount
+	}
+
+	if line.PaymentID == "" {
+		return
+	}
+
+	total, ok := categories[line.Category]
+	if !ok {
+		total = &CategoryTotal{Category: line.Category}
+		categories[line.Category] = total
+	}
+
+	switch line.Kind {
+	case LinePayment:
+		total.Count++
+		total.Spent -= line.Amount
+	case LineRefund:
+		total.Refunded += line.Amount
+	}
+}
+
+// statementKind returns kind of the line for type of event which changed balance
+func statementKind(eventType string) string {
+	switch eventType {
+	case Deposited{}.EventType():
+		return LineDeposit
+	case PaymentCreated{}.EventType():
+		return LinePayment
+	case PaymentRejected{}.EventType(), WithdrawalFailed{}.EventType():
+		return LineRefund
+	case Transferred{}.EventType():
+		return LineTransfer
+	case PaymentCompleted{}.EventType():
+		return LineSettlement
+	case RewardRedeemed{}.EventType():
+		return LineReward
+	case WithdrawalRequested{}.EventType():
+		return LineWithdrawal
+	}
+
+	return LineAdjustment
+}
+
+// paymentOf returns id of payment which is created or refunded by the event
+func paymentOf(event Event) string {
+	switch event := event.(type) {
+	case PaymentCreated:
+		return event.Payment.ID
+	case PaymentRejected:
+		return event.PaymentID
+	}
+
+	return ""
+}
+
+// FormatMoney formats amount stored in minimal units, e.g. 100_50 as 100.50
+func FormatMoney(amount types.Money) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+func formatStatementTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// WriteText renders statement as a plain text table
+func (st *Statement) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Statement of account %d (%s)\n", st.AccountID, st.Phone)
+	fmt.Fprintf(tw, "Period:\t%s - %s\n", formatStatementTime(st.From), formatStatementTime(st.To))
+	fmt.Fprintf(tw, "Opening balance:\t%s\n\n", FormatMoney(st.OpeningBalance))
+
+	fmt.Fprintln(tw, "Time\tKind\tCategory\tAmount\tBalance")
+	for _, line := range st.Lines {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", formatStatementTime(line.Time), line.Kind, line.Category,
+			FormatMoney(line.Amount), FormatMoney(line.Balance))
+	}
+
+	fmt.Fprintln(tw, "\nCategory\tCount\tSpent\tRefunded")
+	for _, total := range st.Categories {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", total.Category, total.Count, FormatMoney(total.Spent), FormatMoney(total.Refunded))
+	}
+
+	if len(st.Pockets) != 0 {
+		fmt.Fprintln(tw, "\nPocket\tGoal\tOpening\tClosing")
+		for _, pocket := range st.Pockets {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", pocket.Name, FormatMoney(pocket.Goal),
+				FormatMoney(pocket.OpeningBalance), FormatMoney(pocket.ClosingBalance))
+		}
+	}
+
+	fmt.Fprintf(tw, "\nTotal in:\t%s\n", FormatMoney(st.TotalIn))
+	fmt.Fprintf(tw, "Total out:\t%s\n", FormatMoney(st.TotalOut))
+	fmt.Fprintf(tw, "Closing balance:\t%s\n", FormatMoney(st.ClosingBalance))
+
+	return tw.Flush()
+}
+
+// WriteCSV renders statement lines as CSV, opening and closing balances are the first and the last rows
+func (st *Statement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	rows := [][]string{
+		{"time", "kind", "payment_id", "category", "amount", "balance"},
+		{formatStatementTime(st.From), "opening", "", "", "", FormatMoney(st.OpeningBalance)},
+	}
+
+	for _, line := range st.Lines {
+		rows = append(rows, []string{formatStatementTime(line.Time), line.Kind, line.PaymentID,
+			string(line.Category), FormatMoney(line.Amount), FormatMoney(line.Balance)})
+	}
+
+	rows = append(rows, []string{formatStatementTime(st.To), "closing", "", "", "", FormatMoney(st.ClosingBalance)})
+
+	err := writer.WriteAll(rows)
+	if err != nil {
+		return err
+	}
+
+	return writer.Error()
+}
+
+// WriteJSON renders statement as JSON document
+func (st *Statement) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(st)
+}
@@ -0,0 +1,195 @@
+package wallet
+
+import (
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Language is used to choose language of rendered statements
+type Language int
+
+// languages
+const (
+	LanguageBilingual Language = iota
+	LanguageRussian
+	LanguageEnglish
+)
+
+// statementLabels contains russian and english version of every label of the HTML statement
+var statementLabels = map[string][2]string{
+	"title":        {"Выписка по счёту", "Account statement"},
+	"account":      {"Счёт", "Account"},
+	"phone":        {"Телефон", "Phone"},
+	"period":       {"Период", "Period"},
+	"opening":      {"Входящий остаток", "Opening balance"},
+	"closing":      {"Исходящий остаток", "Closing balance"},
+	"time":         {"Время", "Time"},
+	"kind":         {"Операция", "Operation"},
+	"category":     {"Категория", "Category"},
+	"amount":       {"Сумма", "Amount"},
+	"balance":      {"Остаток", "Balance"},
+	"count":        {"Количество", "Count"},
+	"spent":        {"Потрачено", "Spent"},
+	"refunded":     {"Возвращено", "Refunded"},
+	"pocket":       {"Копилка", "Pocket"},
+	"goal":         {"Цель", "Goal"},
+	"totalIn":      {"Поступления", "Total in"},
+	"totalOut":     {"Списания", "Total out"},
+	"empty":        {"Операций за период нет", "No operations within period"},
+	"payments":     {"Платежи", "Payments"},
+	"id":           {"Номер", "ID"},
+	"status":       {"Статус", "Status"},
+	LineDeposit:    {"Пополнение", "Deposit"},
+	LinePayment:    {"Платёж", "Payment"},
+	LineRefund:     {"Возврат", "Refund"},
+	LineTransfer:   {"Перевод", "Transfer"},
+	LineSettlement: {"Зачисление от платежа", "Settlement"},
+	LineReward:     {"Кэшбэк", "Reward"},
+	LineWithdrawal: {"Вывод средств", "Withdrawal"},
+	LineAdjustment: {"Корректировка", "Adjustment"},
+
+	string(types.PaymentStatusOk):         {"Проведён", "Completed"},
+	string(types.PaymentStatusFail):       {"Отменён", "Rejected"},
+	string(types.PaymentStatusInProgress): {"В обработке", "In progress"},
+}
+
+const statementCSS = `
+body { font-family: "DejaVu Sans", Arial, sans-serif; font-size: 12px; color: #222; margin: 24px; }
+h1 { font-size: 18px; margin: 0 0 12px; }
+h2 { font-size: 14px; margin: 16px 0 0; }
+table { border-collapse: collapse; width: 100%; margin: 12px 0; }
+th, td { border: 1px solid #999; padding: 4px 6px; text-align: left; }
+th { background: #eee; }
+td.money { text-align: right; white-space: nowrap; }
+td.negative { color: #a00; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 2px 12px; margin: 0; }
+dt { font-weight: bold; }
+dd { margin: 0; }
+@media print {
+	body { margin: 0; }
+	th { background: none; }
+	tr { page-break-inside: avoid; }
+}
+`
+
+var statementTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"money": FormatMoney,
+	"time":  formatStatementTime,
+	"negative": func(amount types.Money) bool {
+		return amount < 0
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{index .Labels "title"}} {{.Statement.AccountID}}</title>
+<style>{{.CSS}}</style>
+</head>
+<body>
+<h1>{{index .Labels "title"}}</h1>
+<dl>
+<dt>{{index .Labels "account"}}</dt><dd>{{.Statement.AccountID}}</dd>
+<dt>{{index .Labels "phone"}}</dt><dd>{{.Statement.Phone}}</dd>
+<dt>{{index .Labels "period"}}</dt><dd>{{time .Statement.From}} — {{time .Statement.To}}</dd>
+<dt>{{index .Labels "opening"}}</dt><dd>{{money .Statement.OpeningBalance}}</dd>
+</dl>
+<table>
+<tr><th>{{index .Labels "time"}}</th><th>{{index .Labels "kind"}}</th><th>{{index .Labels "category"}}</th><th>{{index .Labels "amount"}}</th><th>{{index .Labels "balance"}}</th></tr>
+{{- range .Statement.Lines}}
+<tr><td>{{time .Time}}</td><td>{{index $.Labels .Kind}}</td><td>{{.Category}}</td><td class="money{{if negative .Amount}} negative{{end}}">{{money .Amount}}</td><td class="money">{{money .Balance}}</td></tr>
+{{- else}}
+<tr><td colspan="5">{{index .Labels "empty"}}</td></tr>
+{{- end}}
+</table>
+{{- if .Statement.Categories}}
+<table>
+<tr><th>{{index .Labels "category"}}</th><th>{{index .Labels "count"}}</th><th>{{index .Labels "spent"}}</th><th>{{index .Labels "refunded"}}</th></tr>
+{{- range .Statement.Categories}}
+<tr><td>{{.Category}}</td><td>{{.Count}}</td><td class="money">{{money .Spent}}</td><td class="money">{{money .Refunded}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Payments}}
+<h2>{{index .Labels "payments"}}</h2>
+<table>
+<tr><th>{{index .Labels "time"}}</th><th>{{index .Labels "id"}}</th><th>{{index .Labels "category"}}</th><th>{{index .Labels "amount"}}</th><th>{{index .Labels "status"}}</th></tr>
+{{- range .Payments}}
+<tr><td>{{time .CreatedAt}}</td><td>{{.ID}}</td><td>{{.Category}}</td><td class="money">{{money .Amount}}</td><td>{{index $.Labels (printf "%s" .Status)}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Statement.Pockets}}
+<table>
+<tr><th>{{index .Labels "pocket"}}</th><th>{{index .Labels "goal"}}</th><th>{{index .Labels "opening"}}</th><th>{{index .Labels "closing"}}</th></tr>
+{{- range .Statement.Pockets}}
+<tr><td>{{.Name}}</td><td class="money">{{if .Goal}}{{money .Goal}}{{end}}</td><td class="money">{{money .OpeningBalance}}</td><td class="money">{{money .ClosingBalance}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<dl>
+<dt>{{index .Labels "totalIn"}}</dt><dd>{{money .Statement.TotalIn}}</dd>
+<dt>{{index .Labels "totalOut"}}</dt><dd>{{money .Statement.TotalOut}}</dd>
+<dt>{{index .Labels "closing"}}</dt><dd>{{money .Statement.ClosingBalance}}</dd>
+</dl>
+</body>
+</html>
+`))
+
+// WriteHTML renders statement as a self-contained printable HTML page
+func (st *Statement) WriteHTML(w io.Writer, language Language) error {
+	return st.writeHTML(w, language, nil)
+}
+
+// writeHTML renders statement followed by table of the payments
+func (st *Statement) writeHTML(w io.Writer, language Language, payments []types.Payment) error {
+	labels := make(map[string]string, len(statementLabels))
+	for key, label := range statementLabels {
+		switch language {
+		case LanguageRussian:
+			labels[key] = label[0]
+		case LanguageEnglish:
+			labels[key] = label[1]
+		default:
+			labels[key] = label[0] + " / " + label[1]
+		}
+	}
+
+	lang := "ru"
+	if language == LanguageEnglish {
+		lang = "en"
+	}
+
+	return statementTemplate.Execute(w, struct {
+		Lang      string
+		Labels    map[string]string
+		CSS       template.CSS
+		Statement *Statement
+		Payments  []types.Payment
+	}{lang, labels, template.CSS(statementCSS), st, payments})
+}
+
+// WriteHTMLStatement renders printable statement of the account for period [from, to)
+// together with payments of ExportAccountHistory created within the period
+func (s *Service) WriteHTMLStatement(w io.Writer, accountID int64, from, to time.Time, language Language) error {
+	statement, err := s.Statement(accountID, from, to)
+	if err != nil {
+		return err
+	}
+
+	// ExportAccountHistory returns ErrAccountNotFound for account without payments, account is already found above
+	history, _ := s.ExportAccountHistory(accountID)
+
+	var payments []types.Payment
+	for _, payment := range history {
+		if !from.IsZero() && payment.CreatedAt.Before(from) || !to.IsZero() && !payment.CreatedAt.Before(to) {
+			continue
+		}
+
+		payments = append(payments, payment)
+	}
+
+	return statement.writeHTML(w, language, payments)
+}
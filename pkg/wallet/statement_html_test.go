@@ -0,0 +1,194 @@
+package wallet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_WriteHTMLStatement_bilingual(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(24 * time.Hour)
+
+	_, err = svc.Pay(account.ID, 20_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 5_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	page := &bytes.Buffer{}
+	err = svc.WriteHTMLStatement(page, account.ID, time.Time{}, time.Time{}, LanguageBilingual)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	html := page.String()
+	for _, want := range []string{"Выписка по счёту / Account statement", "Возврат / Refund", "<style>", "85.00"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered statement does not contain %q", want)
+		}
+	}
+
+	if strings.Contains(html, "http") {
+		t.Error("rendered statement must not reference external resources")
+	}
+}
+
+func TestStatement_WriteHTML_english(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(24 * time.Hour)
+
+	_, err = svc.Pay(account.ID, 20_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 5_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	statement, err := svc.Statement(account.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	page := &bytes.Buffer{}
+	err = statement.WriteHTML(page, LanguageEnglish)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	html := page.String()
+	if !strings.Contains(html, `<html lang="en">`) || strings.Contains(html, "Выписка") {
+		t.Errorf("\ngot > %s \nwant > english statement", html)
+	}
+}
+
+func TestService_WriteHTMLStatement_history(t *testing.T) {
+	start := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(24 * time.Hour)
+
+	_, err = svc.Pay(account.ID, 20_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 5_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	page := &bytes.Buffer{}
+	err = svc.WriteHTMLStatement(page, account.ID, start.Add(time.Hour), time.Time{}, LanguageEnglish)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	html := page.String()
+	for _, want := range []string{"<h2>Payments</h2>", "megafon", "Rejected", "In progress", "85.00"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered statement does not contain %q", want)
+		}
+	}
+}
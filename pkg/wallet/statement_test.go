@@ -0,0 +1,235 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestService_Statement_success(t *testing.T) {
+	start := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(24 * time.Hour)
+
+	_, err = svc.Pay(account.ID, 20_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 5_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	statement, err := svc.Statement(account.ID, start.Add(time.Hour), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if statement.OpeningBalance != 100_00 || statement.ClosingBalance != 85_00 {
+		t.Errorf("\ngot > %v %v \nwant > 10000 8500", statement.OpeningBalance, statement.ClosingBalance)
+	}
+
+	kinds := make([]string, 0)
+	for _, line := range statement.Lines {
+		kinds = append(kinds, line.Kind)
+	}
+
+	if strings.Join(kinds, ",") != "payment,payment,refund,deposit" {
+		t.Errorf("\ngot > %v \nwant > payment,payment,refund,deposit", kinds)
+	}
+
+	if statement.Lines[2].Balance != 80_00 || statement.Lines[2].Category != "megafon" {
+		t.Errorf("\ngot > %+v \nwant > refund of megafon with balance 8000", statement.Lines[2])
+	}
+
+	if len(statement.Categories) != 2 || statement.Categories[1].Spent != 10_00 || statement.Categories[1].Refunded != 10_00 {
+		t.Errorf("\ngot > %+v \nwant > megafon spent and refunded 1000", statement.Categories)
+	}
+}
+
+func TestStatement_Render(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC))
+
+	svc := &Service{}
+	svc.SetClock(clock)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(24 * time.Hour)
+
+	_, err = svc.Pay(account.ID, 20_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 5_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	statement, err := svc.Statement(account.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	text := &bytes.Buffer{}
+	err = statement.WriteText(text)
+	if err != nil || !strings.Contains(text.String(), "Closing balance:  85.00") {
+		t.Errorf("\ngot > %v %s \nwant > closing balance 85.00", err, text)
+	}
+
+	data := &bytes.Buffer{}
+	err = statement.WriteCSV(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rows, err := csv.NewReader(data).ReadAll()
+	if err != nil || len(rows) != len(statement.Lines)+3 {
+		t.Errorf("\ngot > %v %v \nwant > %v rows", err, len(rows), len(statement.Lines)+3)
+	}
+
+	document := &bytes.Buffer{}
+	err = statement.WriteJSON(document)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	decoded := Statement{}
+	err = json.Unmarshal(document.Bytes(), &decoded)
+	if err != nil || decoded.ClosingBalance != 85_00 {
+		t.Errorf("\ngot > %v %v \nwant > 8500", err, decoded.ClosingBalance)
+	}
+}
+
+func TestService_Statement_replayed(t *testing.T) {
+	start := time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	svc := &Service{}
+	svc.SetClock(clock)
+	svc.SetEventStore(&MemoryEventStore{})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	clock.Advance(24 * time.Hour)
+
+	_, err = svc.Pay(account.ID, 20_00, "auto")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payment, err := svc.Pay(account.ID, 10_00, "megafon")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Reject(payment.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 5_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	want, err := svc.Statement(account.ID, start.Add(time.Hour), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	replayed, err := svc.At(time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	got, err := replayed.Statement(account.ID, start.Add(time.Hour), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\ngot > %+v \nwant > %+v", got, want)
+	}
+}
@@ -0,0 +1,346 @@
+package wallet
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"github.com/MrHakimov/wallet/pkg/types"
+)
+
+// Errors of withdrawals
+var (
+	ErrNoPayoutProvider        = errors.New("payout provider is not set")
+	ErrInvalidDestination      = errors.New("invalid payout destination")
+	ErrWithdrawalNotFound      = errors.New("withdrawal not found")
+	ErrWithdrawalNotPending    = errors.New("withdrawal is not pending")
+	ErrWithdrawalAlreadyFailed = errors.New("withdrawal already failed")
+	ErrAccountHasWithdrawals   = errors.New("account has pending withdrawals")
+	// ErrPayoutUnavailable is returned by provider when payout can not be sent now,
+	// withdrawal stays pending and is retried by SendWithdrawals
+	ErrPayoutUnavailable = errors.New("payout provider is unavailable")
+)
+
+// DestinationKind is a kind of external payout destination
+type DestinationKind string
+
+// kinds of payout destinations
+const (
+	DestinationCard DestinationKind = "card"
+	DestinationBank DestinationKind = "bank"
+)
+
+// Destination is external card or bank account where withdrawn money is sent
+type Destination struct {
+	Kind   DestinationKind
+	Number string
+	Holder string
+}
+
+// validate checks that destination has known kind and number of digits of proper length
+func (d Destination) validate() error {
+	length := len(d.Number)
+	switch d.Kind {
+	case DestinationCard:
+		if length < 16 || length > 19 {
+			return ErrInvalidDestination
+		}
+	case DestinationBank:
+		if length < 10 || length > 34 {
+			return ErrInvalidDestination
+		}
+	default:
+		return ErrInvalidDestination
+	}
+
+	for _, r := range d.Number {
+		if !unicode.IsDigit(r) {
+			return ErrInvalidDestination
+		}
+	}
+
+	return nil
+}
+
+// WithdrawalStatus represents state of withdrawal
+type WithdrawalStatus string
+
+// withdrawal statuses
+const (
+	WithdrawalStatusPending WithdrawalStatus = "PENDING"
+	WithdrawalStatusSent    WithdrawalStatus = "SENT"
+	WithdrawalStatusFailed  WithdrawalStatus = "FAILED"
+)
+
+// Withdrawal sends money of account to external destination. Amount is debited when withdrawal is requested
+// and returned to account when withdrawal fails
+type Withdrawal struct {
+	ID          string
+	AccountID   int64
+	Amount      types.Money
+	Destination Destination
+	Status      WithdrawalStatus
+	// Reference is id of the payout given by provider, Reason explains failure
+	Reference string
+	Reason    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// PayoutRequest is passed to payout provider to send money
+type PayoutRequest struct {
+	WithdrawalID string
+	AccountID    int64
+	Amount       types.Money
+	Destination  Destination
+}
+
+// PayoutProvider sends money to external destinations and returns reference of the payout.
+// Withdrawal fails when provider returns error other than ErrPayoutUnavailable
+type PayoutProvider interface {
+	SendPayout(request PayoutRequest) (string, error)
+}
+
+// SetPayoutProvider sets provider used by Withdraw and SendWithdrawals
+func (s *Service) SetPayoutProvider(provider PayoutProvider) {
+	s.payouts = provider
+}
+
+// Withdraw debits amount of account and sends it to destination. Bonus balance and funds reserved by holds
+// can not be withdrawn. Withdrawal stays pending when provider is not reachable and is failed when provider declines it
+func (s *Service) Withdraw(accountID int64, amount types.Money, destination Destination) (*Withdrawal, error) {
+	if amount <= 0 {
+		return nil, ErrAmountMustBePositive
+	}
+
+	if s.payouts == nil {
+		return nil, ErrNoPayoutProvider
+	}
+
+	if err := destination.validate(); err != nil {
+		return nil, err
+	}
+
+	account, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkAccountStatus(account); err != nil {
+		return nil, err
+	}
+
+	if s.availableBalance(account) < amount {
+		return nil, ErrNotEnoughBalance
+	}
+
+	now := s.now()
+	err = s.emitAt(now, WithdrawalRequested{Withdrawal: Withdrawal{
+		ID:          uuid.New().String(),
+		AccountID:   account.ID,
+		Amount:      amount,
+		Destination: destination,
+		Status:      WithdrawalStatusPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawal := s.withdrawals[len(s.withdrawals)-1]
+
+	if err := s.send(withdrawal); err != nil && !errors.Is(err, ErrPayoutUnavailable) {
+		return withdrawal, err
+	}
+
+	return withdrawal, nil
+}
+
+// SendWithdrawals retries all pending withdrawals and returns number of withdrawals which were sent.
+// Sending stops at the first withdrawal whose event can not be stored
+func (s *Service) SendWithdrawals() (int, error) {
+	if s.payouts == nil {
+		return 0, ErrNoPayoutProvider
+	}
+
+	var pending []*Withdrawal
+	for _, withdrawal := range s.withdrawals {
+		if withdrawal.Status == WithdrawalStatusPending {
+			pending = append(pending, withdrawal)
+		}
+	}
+
+	count := 0
+	for _, withdrawal := range pending {
+		err := s.send(withdrawal)
+		if err == nil {
+			count++
+			continue
+		}
+
+		// declined withdrawal is failed, withdrawal which stays pending after other error was not stored
+		if withdrawal.Status == WithdrawalStatusPending && !errors.Is(err, ErrPayoutUnavailable) {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// FailWithdrawal fails pending or sent withdrawal, e.g. when provider reports that payout bounced,
+// and returns its amount to account
+func (s *Service) FailWithdrawal(withdrawalID string, reason string) error {
+	withdrawal, err := s.FindWithdrawalByID(withdrawalID)
+	if err != nil {
+		return err
+	}
+
+	if withdrawal.Status == WithdrawalStatusFailed {
+		return ErrWithdrawalAlreadyFailed
+	}
+
+	return s.emit(WithdrawalFailed{WithdrawalID: withdrawal.ID, AccountID: s.refundAccount(withdrawal.AccountID),
+		Amount: withdrawal.Amount, Reason: reason})
+}
+
+// FindWithdrawalByID returns withdrawal by id
+func (s *Service) FindWithdrawalByID(withdrawalID string) (*Withdrawal, error) {
+	for _, withdrawal := range s.withdrawals {
+		if withdrawal.ID == withdrawalID {
+			return withdrawal, nil
+		}
+	}
+
+	return nil, ErrWithdrawalNotFound
+}
+
+// Withdrawals returns withdrawals of account in order they were requested
+func (s *Service) Withdrawals(accountID int64) ([]Withdrawal, error) {
+	_, err := s.FindAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var withdrawals []Withdrawal
+	for _, withdrawal := range s.withdrawals {
+		if withdrawal.AccountID == accountID {
+			withdrawals = append(withdrawals, *withdrawal)
+		}
+	}
+
+	return withdrawals, nil
+}
+
+// send passes pending withdrawal to provider, declined withdrawal is failed and its error is returned
+func (s *Service) send(withdrawal *Withdrawal) error {
+	if withdrawal.Status != WithdrawalStatusPending {
+		return ErrWithdrawalNotPending
+	}
+
+	reference, err := s.payouts.SendPayout(PayoutRequest{
+		WithdrawalID: withdrawal.ID,
+		AccountID:    withdrawal.AccountID,
+		Amount:       withdrawal.Amount,
+		Destination:  withdrawal.Destination,
+	})
+	if errors.Is(err, ErrPayoutUnavailable) {
+		return err
+	}
+
+	if err != nil {
+		failed := s.emit(WithdrawalFailed{WithdrawalID: withdrawal.ID, AccountID: s.refundAccount(withdrawal.AccountID),
+			Amount: withdrawal.Amount, Reason: err.Error()})
+		if failed != nil {
+			return failed
+		}
+		return err
+	}
+
+	return s.emit(WithdrawalSent{WithdrawalID: withdrawal.ID, AccountID: withdrawal.AccountID, Reference: reference})
+}
+
+// hasWithdrawals tells whether account has withdrawals which are not sent to provider yet
+func (s *Service) hasWithdrawals(accountID int64) bool {
+	for _, withdrawal := range s.withdrawals {
+		if withdrawal.AccountID == accountID && withdrawal.Status == WithdrawalStatusPending {
+			return true
+		}
+	}
+
+	return false
+}
+
+// refundAccount returns account which receives refund of failed withdrawal of the account,
+// closed accounts are refunded through their payout accounts
+func (s *Service) refundAccount(accountID int64) int64 {
+	// every account is closed at most once, so the chain is not longer than number of accounts
+	for range s.accounts {
+		payout, ok := s.payoutAccounts[accountID]
+		if !ok {
+			break
+		}
+
+		accountID = payout
+	}
+
+	return accountID
+}
+
+// FakePayoutProvider is local payout provider which sends nothing, it declines destinations listed in Declined
+// and returns Err for all payouts when it is set
+type FakePayoutProvider struct {
+	Declined map[string]error
+	Err      error
+
+	mu      sync.Mutex
+	payouts []PayoutRequest
+}
+
+// SendPayout implements PayoutProvider
+func (f *FakePayoutProvider) SendPayout(request PayoutRequest) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return "", f.Err
+	}
+
+	if err, ok := f.Declined[request.Destination.Number]; ok {
+		return "", err
+	}
+
+	f.payouts = append(f.payouts, request)
+
+	return "fake-" + strconv.Itoa(len(f.payouts)), nil
+}
+
+// Payouts returns requests of all sent payouts
+func (f *FakePayoutProvider) Payouts() []PayoutRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	payouts := make([]PayoutRequest, len(f.payouts))
+	copy(payouts, f.payouts)
+
+	return payouts
+}
+
+// applyWithdrawal changes status of withdrawal, it is called by apply
+func (s *Service) applyWithdrawal(withdrawalID string, status WithdrawalStatus, reference, reason string, now time.Time) {
+	withdrawal, err := s.FindWithdrawalByID(withdrawalID)
+	if err != nil {
+		return
+	}
+
+	withdrawal.Status = status
+	if reference != "" {
+		withdrawal.Reference = reference
+	}
+	withdrawal.Reason = reason
+	withdrawal.UpdatedAt = now
+}
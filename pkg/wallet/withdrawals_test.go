@@ -0,0 +1,232 @@
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestService_Withdraw_success(t *testing.T) {
+	svc := &Service{}
+	svc.SetEventStore(&MemoryEventStore{})
+	provider := &FakePayoutProvider{}
+	svc.SetPayoutProvider(provider)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	card := Destination{Kind: DestinationCard, Number: "4111111111111111", Holder: "IVAN IVANOV"}
+	if _, err := svc.Withdraw(account.ID, 10_00, Destination{Kind: DestinationCard, Number: "4111"}); err != ErrInvalidDestination {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrInvalidDestination)
+	}
+
+	if _, err := svc.Withdraw(account.ID, 101_00, card); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrNotEnoughBalance)
+	}
+
+	withdrawal, err := svc.Withdraw(account.ID, 60_00, card)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if withdrawal.Status != WithdrawalStatusSent || withdrawal.Reference != "fake-1" || account.Balance != 40_00 {
+		t.Errorf("\ngot > %+v, balance %v \nwant > sent withdrawal", withdrawal, account.Balance)
+	}
+
+	if payouts := provider.Payouts(); len(payouts) != 1 || payouts[0].Amount != 60_00 || payouts[0].WithdrawalID != withdrawal.ID {
+		t.Errorf("\ngot > %+v \nwant > one payout", payouts)
+	}
+
+	err = svc.FailWithdrawal(withdrawal.ID, "card is blocked")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.FailWithdrawal(withdrawal.ID, "again"); err != ErrWithdrawalAlreadyFailed {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrWithdrawalAlreadyFailed)
+	}
+
+	if withdrawal.Status != WithdrawalStatusFailed || withdrawal.Reason != "card is blocked" || account.Balance != 100_00 {
+		t.Errorf("\ngot > %+v, balance %v \nwant > failed withdrawal", withdrawal, account.Balance)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+
+	rebuilt, err := Rebuild(svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	withdrawals, _ := rebuilt.Withdrawals(account.ID)
+	if len(withdrawals) != 1 || withdrawals[0].Status != WithdrawalStatusFailed || withdrawals[0].Reference != "fake-1" {
+		t.Errorf("\ngot > %+v \nwant > failed withdrawal after rebuild", withdrawals)
+	}
+}
+
+func TestService_Withdraw_providerErrors(t *testing.T) {
+	declined := errors.New("account is closed")
+	provider := &FakePayoutProvider{Declined: map[string]error{"40817810099910004312": declined}}
+	svc := &Service{}
+	svc.SetPayoutProvider(provider)
+
+	_, err := svc.CreatePromo(PromoCampaign{Code: "welcome", Bonus: 50_00})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	_, err = svc.DepositWithPromo(account.ID, 100_00, "welcome")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	bank := Destination{Kind: DestinationBank, Number: "40817810099910004312"}
+	card := Destination{Kind: DestinationCard, Number: "5500000000000004"}
+
+	if _, err := svc.Withdraw(account.ID, 150_00, card); err != ErrNotEnoughBalance {
+		t.Errorf("\ngot > %v \nwant > bonus can not be withdrawn", err)
+	}
+
+	withdrawal, err := svc.Withdraw(account.ID, 30_00, bank)
+	if err != declined || withdrawal.Status != WithdrawalStatusFailed || account.Balance != 100_00 {
+		t.Errorf("\ngot > %v, %+v \nwant > declined withdrawal", err, withdrawal)
+	}
+
+	provider.Err = ErrPayoutUnavailable
+	withdrawal, err = svc.Withdraw(account.ID, 30_00, card)
+	if err != nil || withdrawal.Status != WithdrawalStatusPending || account.Balance != 70_00 {
+		t.Errorf("\ngot > %v, %+v \nwant > pending withdrawal", err, withdrawal)
+	}
+
+	provider.Err = nil
+	count, err := svc.SendWithdrawals()
+	if err != nil || count != 1 || withdrawal.Status != WithdrawalStatusSent {
+		t.Errorf("\ngot > %v, %v, %v \nwant > pending withdrawal sent", count, err, withdrawal.Status)
+	}
+
+	report := svc.Reconcile()
+	if !report.OK() {
+		t.Errorf("\ngot > %+v \nwant > no issues", report.Issues)
+	}
+}
+
+func TestService_FailWithdrawal_closedAccount(t *testing.T) {
+	svc := &Service{}
+	svc.SetEventStore(&MemoryEventStore{})
+	provider := &FakePayoutProvider{Err: ErrPayoutUnavailable}
+	svc.SetPayoutProvider(provider)
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	payout, err := svc.RegisterAccount("+992000000002")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	withdrawal, err := svc.Withdraw(account.ID, 100_00, Destination{Kind: DestinationCard, Number: "4111111111111111"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if err := svc.CloseAccount(account.ID); err != ErrAccountHasWithdrawals {
+		t.Errorf("\ngot > %v \nwant > %v", err, ErrAccountHasWithdrawals)
+	}
+
+	err = svc.CloseAccountWithPayout(account.ID, payout.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	provider.Err = nil
+	if sent, _ := svc.SendWithdrawals(); sent != 1 || withdrawal.Status != WithdrawalStatusSent {
+		t.Errorf("\ngot > %v, %v \nwant > withdrawal of closed account is sent", sent, withdrawal.Status)
+	}
+
+	err = svc.FailWithdrawal(withdrawal.ID, "card is blocked")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if account.Balance != 0 || payout.Balance != 100_00 || withdrawal.Status != WithdrawalStatusFailed {
+		t.Errorf("\ngot > account %v, payout %v, %v \nwant > refund in payout account", account.Balance, payout.Balance, withdrawal.Status)
+	}
+
+	rebuilt, err := Rebuild(svc.EventStore(), time.Time{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if balance, _ := rebuilt.AvailableBalance(payout.ID); balance != 100_00 {
+		t.Errorf("\ngot > %v \nwant > %v after rebuild", balance, 100_00)
+	}
+
+	err = svc.VerifyLedger()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestService_CloseAccount_sentWithdrawal(t *testing.T) {
+	svc := &Service{}
+	svc.SetPayoutProvider(&FakePayoutProvider{})
+
+	account, err := svc.RegisterAccount("+992000000001")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = svc.Deposit(account.ID, 100_00)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	withdrawal, err := svc.Withdraw(account.ID, 100_00, Destination{Kind: DestinationCard, Number: "4111111111111111"})
+	if err != nil || withdrawal.Status != WithdrawalStatusSent {
+		t.Errorf("\ngot > %v, %v \nwant > sent withdrawal", withdrawal, err)
+		return
+	}
+
+	err = svc.CloseAccount(account.ID)
+	if err != nil {
+		t.Errorf("\ngot > %v \nwant > account with sent withdrawals is closed", err)
+	}
+}